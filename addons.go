@@ -5,8 +5,8 @@ package bmdb
 // Returns an error if the bucket was created from a read-only transaction,
 // if the key is too large, or if the value is too large.
 func (tx *Tx) Put(key, value []byte) error {
-	if tx.done {
-		return ErrTxDone
+	if err := tx.check(); err != nil {
+		return err
 	} else if !tx.Writable() {
 		return ErrTxNotWritable
 	} else if len(key) == 0 {
@@ -26,7 +26,7 @@ func (tx *Tx) Put(key, value []byte) error {
 // Get retrieves the value for a key in the default bucket.
 // Returns a nil value if the key does not exist or the transaction is done.
 func (tx *Tx) Get(key []byte) []byte {
-	if tx.done {
+	if tx.check() != nil {
 		return nil
 	}
 	b := tx.Bucket(DefaultBucketName)
@@ -37,7 +37,7 @@ func (tx *Tx) Get(key []byte) []byte {
 }
 
 func (b *Bucket) Exists(key []byte) bool {
-	if b.tx.done {
+	if b.tx.check() != nil {
 		return false
 	}
 	_, err := b.tx.txn.Get(b.dbi, key)
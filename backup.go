@@ -0,0 +1,68 @@
+package bmdb
+
+import (
+	"io"
+	"os"
+
+	"github.com/missionMeteora/bmdb/mdb"
+)
+
+// CopyOptions represents the options of a database copy.
+type CopyOptions struct {
+	// Compact omits the free pages and renumbers the pages sequentially,
+	// which makes the copy as small as possible at the cost of more CPU time.
+	Compact bool
+}
+
+func (opts CopyOptions) flags() uint {
+	if opts.Compact {
+		return mdb.CP_COMPACT
+	}
+	return 0
+}
+
+// CopyTo writes a consistent copy of the database into the directory at path, which must already exist.
+// The copy is made from a read-only transaction, so writers are not blocked while it runs.
+func (db *DB) CopyTo(path string, opts CopyOptions) error {
+	if db.closed {
+		return ErrDatabaseNotOpen
+	}
+	db.acquireMap(false)
+	defer db.releaseMap()
+	return db.env.Copy2(path, opts.flags())
+}
+
+// WriteTo writes a consistent copy of the database's data file to w.
+// The copy is made from a read-only transaction, so writers are not blocked while it runs.
+func (db *DB) WriteTo(w io.Writer) (int64, error) {
+	return db.CopyToWriter(w, CopyOptions{})
+}
+
+// CopyToWriter is like WriteTo, with the given copy options.
+func (db *DB) CopyToWriter(w io.Writer, opts CopyOptions) (int64, error) {
+	if db.closed {
+		return 0, ErrDatabaseNotOpen
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		db.acquireMap(false)
+		err := db.env.CopyFD(pw.Fd(), opts.flags())
+		db.releaseMap()
+		pw.Close()
+		errc <- err
+	}()
+	n, err := io.Copy(w, pr)
+	if err != nil {
+		// keep draining the pipe so that the copy can finish
+		io.Copy(io.Discard, pr)
+	}
+	pr.Close()
+	if copyErr := <-errc; copyErr != nil {
+		return n, copyErr
+	}
+	return n, err
+}
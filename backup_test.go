@@ -0,0 +1,51 @@
+package bmdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func checkBackup(t *testing.T, path string) {
+	assert := assert.New(t)
+	db, err := Open(path, 0644, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.View(func(tx *Tx) error {
+		keys, err := collectRange(tx.Bucket(FOO), nil, nil, false)
+		assert.NoError(err)
+		assert.Len(keys, len(testKeys))
+		return nil
+	}))
+}
+
+func TestBackup(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+
+		var buf bytes.Buffer
+		n, err := db.WriteTo(&buf)
+		if !assert.NoError(err) {
+			return
+		}
+		assert.Equal(int64(buf.Len()), n)
+		streamed := db.Path() + ".stream"
+		assert.NoError(os.MkdirAll(streamed, 0755))
+		assert.NoError(ioutil.WriteFile(filepath.Join(streamed, "data.mdb"), buf.Bytes(), 0644))
+		checkBackup(t, streamed)
+
+		compacted := db.Path() + ".compact"
+		assert.NoError(os.MkdirAll(compacted, 0755))
+		assert.NoError(db.CopyTo(compacted, CopyOptions{Compact: true}))
+		checkBackup(t, compacted)
+	})
+}
@@ -0,0 +1,152 @@
+package bmdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errTrySolo is sent to a batched call that has to be executed again on its own.
+var errTrySolo = errors.New("batch function returned an error and should be re-run solo")
+
+// Batch calls fn as part of a batch of concurrent calls that share a single read-write transaction.
+// The batch is committed once it holds Options.MaxBatchSize calls or Options.MaxBatchDelay has elapsed,
+// whichever comes first, which saves one commit per call at the cost of some latency.
+//
+// Each call runs in its own nested transaction, so if fn returns an error only its updates are
+// rolled back, and then fn is executed again on its own through Update. This means fn must be
+// idempotent and only its error from the solo execution is returned to the caller.
+// LMDB doesn't support nested transactions with WRITEMAP, which Options.NoSync enables, so then the calls
+// run directly in the shared transaction: if one fails the transaction is rolled back, the failed call
+// is executed again on its own and the batch is retried without it.
+//
+// Batch is only useful when there are multiple goroutines calling it.
+func (db *DB) Batch(fn func(*Tx) error) error {
+	if db.opts.ReadOnly {
+		return ErrDatabaseReadOnly
+	}
+	errCh := make(chan error, 1)
+
+	db.batchMux.Lock()
+	if db.batch == nil || len(db.batch.calls) >= db.opts.MaxBatchSize {
+		// there is no existing batch, or the existing batch is full; start a new one
+		db.batch = &batch{db: db}
+		db.batch.timer = time.AfterFunc(db.opts.MaxBatchDelay, db.batch.trigger)
+	}
+	db.batch.calls = append(db.batch.calls, call{fn: fn, err: errCh})
+	if len(db.batch.calls) >= db.opts.MaxBatchSize {
+		// wake up the batch, it's ready to run
+		go db.batch.trigger()
+	}
+	db.batchMux.Unlock()
+
+	err := <-errCh
+	if err == errTrySolo {
+		err = db.Update(fn)
+	}
+	return err
+}
+
+type call struct {
+	fn  func(*Tx) error
+	err chan<- error
+}
+
+type batch struct {
+	db    *DB
+	timer *time.Timer
+	start sync.Once
+	calls []call
+}
+
+// trigger runs the batch if it hasn't already been run.
+func (b *batch) trigger() {
+	b.start.Do(b.run)
+}
+
+// run executes the calls of the batch and reports the results back to the callers.
+func (b *batch) run() {
+	b.db.batchMux.Lock()
+	b.timer.Stop()
+	// make sure no new work is added to this batch
+	if b.db.batch == b {
+		b.db.batch = nil
+	}
+	b.db.batchMux.Unlock()
+
+	if !b.db.nestedTxSupported() {
+		b.runShared()
+		return
+	}
+	failed := make([]bool, len(b.calls))
+	err := b.db.Update(func(tx *Tx) error {
+		// the function is executed again if the map is grown, only the last attempt counts
+		clear(failed)
+		for i, c := range b.calls {
+			if err := tx.Update(func(child *Tx) error {
+				return safelyCall(c.fn, child)
+			}); err != nil {
+				failed[i] = true
+			}
+		}
+		return nil
+	})
+	for i, c := range b.calls {
+		if failed[i] {
+			c.err <- errTrySolo
+		} else {
+			c.err <- err
+		}
+	}
+}
+
+// runShared executes the calls of the batch directly in the shared transaction, the failed calls
+// are removed from the batch to be executed again on their own and the rest of the batch is retried.
+func (b *batch) runShared() {
+	for len(b.calls) > 0 {
+		failIdx := -1
+		err := b.db.Update(func(tx *Tx) error {
+			failIdx = -1
+			for i, c := range b.calls {
+				if err := safelyCall(c.fn, tx); err != nil {
+					failIdx = i
+					return err
+				}
+			}
+			return nil
+		})
+		if failIdx >= 0 {
+			// take the failing call out of the batch, and retry the batch
+			c := b.calls[failIdx]
+			b.calls[failIdx], b.calls = b.calls[len(b.calls)-1], b.calls[:len(b.calls)-1]
+			c.err <- errTrySolo
+			continue
+		}
+		for _, c := range b.calls {
+			c.err <- err
+		}
+		return
+	}
+}
+
+// panicked is the error returned by a batched function that panicked.
+type panicked struct {
+	reason interface{}
+}
+
+func (p panicked) Error() string {
+	if err, ok := p.reason.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprintf("panic: %v", p.reason)
+}
+
+func safelyCall(fn func(*Tx) error, tx *Tx) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = panicked{p}
+		}
+	}()
+	return fn(tx)
+}
@@ -0,0 +1,88 @@
+package bmdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		testBatch(t, db)
+	})
+}
+
+func TestBatchWriteMap(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{NoSync: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	var commits atomic.Int32
+	db.OnTxEnd(func(tx *Tx, committed bool) {
+		if committed && tx.Writable() {
+			commits.Add(1)
+		}
+	})
+	testBatch(t, db)
+	// the batch is retried once without the failing call, which is then executed on its own
+	assert.Less(commits.Load(), int32(20))
+}
+
+func testBatch(t *testing.T, db *DB) {
+	assert := assert.New(t)
+	errBad := errors.New("bad call")
+	const n = 20
+	var (
+		wg    sync.WaitGroup
+		mux   sync.Mutex
+		runs  = make(map[int]int, n)
+		errs  = make([]error, n)
+		calls = func(i int) {
+			mux.Lock()
+			runs[i]++
+			mux.Unlock()
+		}
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.Batch(func(tx *Tx) error {
+				calls(i)
+				if err := tx.Put([]byte(fmt.Sprintf("%02d", i)), BAR); err != nil {
+					return err
+				}
+				if i == 7 {
+					return errBad
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if i == 7 {
+			assert.Equal(errBad, errs[i])
+			assert.True(runs[i] >= 2)
+			continue
+		}
+		assert.NoError(errs[i])
+	}
+	assert.NoError(db.View(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			v := tx.Get([]byte(fmt.Sprintf("%02d", i)))
+			if i == 7 {
+				assert.Nil(v)
+			} else {
+				assert.Equal(BAR, v)
+			}
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,59 @@
+package bmdb
+
+import (
+	"testing"
+)
+
+// repeatedly open a bucket and get a key from it, the bucket handle is cached by the DB.
+func BenchmarkTxBucketGet(b *testing.B) {
+	db, err := getDB()
+	if err != nil {
+		b.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+	if err = db.Update(func(tx *Tx) error {
+		return tx.Put(FOO, BAR)
+	}); err != nil {
+		b.Fatalf("error putting data: %v", err)
+	}
+	tx, err := db.Begin(false)
+	if err != nil {
+		b.Fatalf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if tx.Get(FOO) == nil {
+			b.Fatal("missing value")
+		}
+	}
+	b.StopTimer()
+}
+
+// same as BenchmarkTxBucketGet, but the bucket handle is opened again on every call.
+func BenchmarkTxBucketGetUncached(b *testing.B) {
+	db, err := getDB()
+	if err != nil {
+		b.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+	if err = db.Update(func(tx *Tx) error {
+		return tx.Put(FOO, BAR)
+	}); err != nil {
+		b.Fatalf("error putting data: %v", err)
+	}
+	tx, err := db.Begin(false)
+	if err != nil {
+		b.Fatalf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.uncacheDBI(string(DefaultBucketName))
+		tx.dbis = nil
+		if tx.Get(FOO) == nil {
+			b.Fatal("missing value")
+		}
+	}
+	b.StopTimer()
+}
@@ -1,10 +1,16 @@
 package bmdb
 
-import "github.com/missionMeteora/bmdb/mdb"
+import (
+	"github.com/missionMeteora/bmdb/mdb"
+)
 
 type Bucket struct {
-	dbi mdb.DBI
-	tx  *Tx
+	dbi   mdb.DBI
+	tx    *Tx
+	name  []byte
+	flags uint
+	// names is set for the unnamed bucket returned by Tx.BucketNames
+	names bool
 }
 
 // Writable returns whether the bucket is writable.
@@ -16,23 +22,25 @@ func (b *Bucket) Writable() bool {
 // The cursor is only valid as long as the transaction is open.
 // Do not use a cursor after the transaction is closed.
 func (b *Bucket) Cursor() (*Cursor, error) {
-	if b.tx.done {
-		return nil, ErrTxDone
-	}
-	c, err := b.tx.txn.CursorOpen(b.dbi)
-	if err != nil {
+	if err := b.tx.check(); err != nil {
 		return nil, err
 	}
-	if !b.tx.Writable() {
-		b.tx.registerCursor((*Cursor)(c))
+	slot := cursorSlot{dbi: b.dbi, dupSort: b.dupSort()}
+	mc, err := b.tx.cursorOpen(slot)
+	if err != nil {
+		return nil, wrapError("cursor", b.name, err)
 	}
-	return (*Cursor)(c), nil
+	c := &Cursor{tx: b.tx, cursor: mc, slot: slot, bucket: b.name, names: b.names}
+	b.tx.registerCursor(c)
+	return c, nil
 }
 
 // Get retrieves the value for a key in the bucket.
-// Returns a nil value if the key does not exist or the transaction is done.
+// Returns a nil value if the key does not exist or the transaction is done, use GetE to tell them apart.
 func (b *Bucket) Get(key []byte) []byte {
-	if b.tx.done {
+	if b.tx.check() != nil {
+		return nil
+	} else if b.names && isHiddenName(key) {
 		return nil
 	}
 	v, err := b.tx.txn.Get(b.dbi, key)
@@ -42,32 +50,313 @@ func (b *Bucket) Get(key []byte) []byte {
 	return v
 }
 
+// GetE retrieves the value for a key in the bucket.
+// Unlike Get it reports why no value was returned: a missing key is an *Error that unwraps to mdb.NotFound,
+// while a failure such as a corrupted page unwraps to the corresponding mdb.Errno.
+func (b *Bucket) GetE(key []byte) ([]byte, error) {
+	if err := b.tx.check(); err != nil {
+		return nil, err
+	} else if b.names && isHiddenName(key) {
+		return nil, wrapError("get", b.name, mdb.NotFound)
+	}
+	v, err := b.tx.txn.Get(b.dbi, key)
+	if err != nil {
+		return nil, wrapError("get", b.name, err)
+	}
+	return v, nil
+}
+
+// GetNoCopy is like Get, but the returned value points directly into the memory map instead of being copied.
+// The value must not be modified and is only valid until the transaction is closed.
+// In a writable transaction the value is copied anyway, since LMDB only keeps it valid until the next update.
+func (b *Bucket) GetNoCopy(key []byte) []byte {
+	if b.tx.check() != nil {
+		return nil
+	} else if b.names && isHiddenName(key) {
+		return nil
+	}
+	v, err := b.tx.txn.GetVal(b.dbi, key)
+	if err != nil {
+		return nil
+	}
+	return b.tx.bytesNoCopy(v)
+}
+
 func (b *Bucket) Put(key, val []byte) error {
-	if b.tx.done {
-		return ErrTxDone
+	if err := b.tx.check(); err != nil {
+		return err
 	} else if !b.tx.Writable() {
 		return ErrTxNotWritable
 	}
-	return b.tx.txn.Put(b.dbi, key, val, 0)
+	return wrapError("put", b.name, b.tx.txn.Put(b.dbi, key, val, 0))
+}
+
+// PutReserve reserves size bytes for the value of a key and calls fn to fill them in place,
+// which saves building and copying large values. The buffer points into the memory map
+// and must not be used after fn returns. If fn returns an error the value of the key is left
+// undefined and the error is returned, so the transaction should be rolled back.
+// Returns an error if the transaction is done or not writable, or if the bucket is a DUPSORT one.
+func (b *Bucket) PutReserve(key []byte, size int, fn func(buf []byte) error) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if !b.tx.Writable() {
+		return ErrTxNotWritable
+	} else if b.dupSort() {
+		return ErrReserveDupSort
+	} else if size < 0 || uint64(size) > MaxValueSize {
+		return ErrValueTooLarge
+	}
+	buf, err := b.tx.txn.PutReserve(b.dbi, key, size, 0)
+	if err != nil {
+		return wrapError("put", b.name, err)
+	}
+	return fn(buf)
 }
 
 func (b *Bucket) Delete(key []byte) error {
-	if b.tx.done {
-		return ErrTxDone
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if !b.tx.Writable() {
+		return ErrTxNotWritable
+	}
+	return wrapError("delete", b.name, b.tx.txn.Del(b.dbi, key, nil))
+}
+
+// PutDup adds a value to the values stored for a key in a DUPSORT bucket.
+// Adding a value that is already stored for the key has no effect.
+// Returns an error if the transaction is done or not writable, or if the bucket does not support duplicates.
+func (b *Bucket) PutDup(key, val []byte) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if !b.tx.Writable() {
+		return ErrTxNotWritable
+	} else if !b.dupSort() {
+		return ErrNotDupSort
+	}
+	err := b.tx.txn.Put(b.dbi, key, val, mdb.NODUPDATA)
+	if err == mdb.KeyExist {
+		return nil
+	}
+	return wrapError("put", b.name, err)
+}
+
+// GetAll retrieves all the values stored for a key, in sorted order.
+// Returns nil if the key does not exist or the transaction is done.
+func (b *Bucket) GetAll(key []byte) [][]byte {
+	c, err := b.Cursor()
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+	var vals [][]byte
+	for k, v := c.get(key, nil, mdb.SET_KEY); k != nil; k, v = c.NextDup() {
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+// DeleteDup removes a single value stored for a key in a DUPSORT bucket.
+// Use Delete to remove the key along with all its values.
+func (b *Bucket) DeleteDup(key, val []byte) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if !b.tx.Writable() {
+		return ErrTxNotWritable
+	} else if !b.dupSort() {
+		return ErrNotDupSort
+	}
+	return wrapError("delete", b.name, b.tx.txn.Del(b.dbi, key, val))
+}
+
+// CountDups returns the number of values stored for a key.
+// Returns zero if the key does not exist.
+func (b *Bucket) CountDups(key []byte) (uint64, error) {
+	c, err := b.Cursor()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	if k, _ := c.get(key, nil, mdb.SET_KEY); k == nil {
+		return 0, nil
+	}
+	return c.Count()
+}
+
+// Sequence returns the current value of the bucket's sequence without incrementing it.
+func (b *Bucket) Sequence() uint64 {
+	if b.tx.check() != nil || b.name == nil {
+		return 0
+	}
+	seq, err := b.tx.sequence(b.name)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+// SetSequence updates the value of the bucket's sequence.
+// Returns an error if the transaction is done or not writable.
+func (b *Bucket) SetSequence(seq uint64) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if !b.tx.Writable() {
+		return ErrTxNotWritable
+	} else if b.name == nil {
+		return ErrNoBucketName
+	}
+	return b.tx.setSequence(b.name, seq)
+}
+
+// NextSequence increments the bucket's sequence and returns its new value.
+// The sequence is stored along with the data, so rolling back the transaction also rolls back the sequence.
+// Returns an error if the transaction is done or not writable.
+func (b *Bucket) NextSequence() (uint64, error) {
+	if err := b.tx.check(); err != nil {
+		return 0, err
+	} else if !b.tx.Writable() {
+		return 0, ErrTxNotWritable
+	} else if b.name == nil {
+		return 0, ErrNoBucketName
+	}
+	seq, err := b.tx.sequence(b.name)
+	if err != nil {
+		return 0, err
+	}
+	seq++
+	if err = b.tx.setSequence(b.name, seq); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+func (b *Bucket) dupSort() bool {
+	return b.flags&mdb.DUPSORT != 0
+}
+
+// Bucket retrieves a nested bucket by name. Returns nil if the bucket does not exist.
+func (b *Bucket) Bucket(name []byte) *Bucket {
+	if b.tx.check() != nil {
+		return nil
+	}
+	full, err := b.nestedName(name)
+	if err != nil {
+		return nil
+	}
+	return b.tx.openBucket(full)
+}
+
+// CreateBucket creates a new bucket nested in the bucket.
+// Each nested bucket is a database of its own, so it counts towards Options.MaxBuckets,
+// ErrTooManyBuckets is returned once they are all in use.
+// Returns an error if the bucket already exists, if the bucket name is blank, or if the bucket name is too long.
+func (b *Bucket) CreateBucket(name []byte) (*Bucket, error) {
+	return b.CreateBucketWithOptions(name, BucketOptions{})
+}
+
+// CreateBucketWithOptions creates a new bucket nested in the bucket with the given options.
+// Returns an error if the bucket already exists, if the bucket name is blank, if the bucket name is too long,
+// or if the options are invalid.
+func (b *Bucket) CreateBucketWithOptions(name []byte, opts BucketOptions) (*Bucket, error) {
+	if err := b.tx.check(); err != nil {
+		return nil, err
+	}
+	full, err := b.nestedName(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.tx.createBucket(full, opts)
+}
+
+// CreateBucketIfNotExists creates a new nested bucket if it doesn't already exist.
+// Returns an error if the bucket name is blank, or if the bucket name is too long.
+func (b *Bucket) CreateBucketIfNotExists(name []byte) (*Bucket, error) {
+	if err := b.tx.check(); err != nil {
+		return nil, err
+	}
+	full, err := b.nestedName(name)
+	if err != nil {
+		return nil, err
+	}
+	if child := b.tx.openBucket(full); child != nil {
+		return child, nil
+	}
+	return b.tx.createBucket(full, BucketOptions{})
+}
+
+// DeleteBucket deletes a nested bucket along with its own nested buckets.
+// Returns an error if the bucket cannot be found or the provided name was incorrect.
+func (b *Bucket) DeleteBucket(name []byte) error {
+	if err := b.tx.check(); err != nil {
+		return err
 	} else if !b.tx.Writable() {
 		return ErrTxNotWritable
 	}
-	return b.tx.txn.Del(b.dbi, key, nil)
+	full, err := b.nestedName(name)
+	if err != nil {
+		return err
+	}
+	return b.tx.deleteBucket(full)
+}
+
+// ForEachBucket executes a function for the name of each bucket directly nested in the bucket.
+// If the provided function returns an error then the iteration is stopped and the error is returned.
+func (b *Bucket) ForEachBucket(fn func(name []byte) error) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if b.name == nil {
+		return ErrNoBucketName
+	}
+	names, err := b.tx.nestedBucketNames(b.name, false)
+	if err != nil {
+		return err
+	}
+	for _, full := range names {
+		if err = fn(full[len(b.name)+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nestedName returns the full name of a bucket nested in the bucket.
+func (b *Bucket) nestedName(name []byte) ([]byte, error) {
+	if b.name == nil {
+		return nil, ErrNoBucketName
+	} else if err := checkName(name); err != nil {
+		return nil, err
+	}
+	full := nestedName(b.name, name)
+	if len(full) > maxFullNameLength {
+		return nil, ErrNameTooLong
+	}
+	return full, nil
 }
 
 func (b *Bucket) Tx() *Tx {
 	return b.tx
 }
 
+// Info returns the record of the bucket kept in the metadata: the options it was created with
+// and its creation time. Returns nil if the bucket has no record, i.e. it was created by an older version.
+func (b *Bucket) Info() (*BucketInfo, error) {
+	if err := b.tx.check(); err != nil {
+		return nil, err
+	} else if b.name == nil {
+		return nil, ErrNoBucketName
+	}
+	return b.tx.bucketInfo(b.name)
+}
+
 func (b *Bucket) Stats() (*mdb.Stat, error) {
+	if err := b.tx.check(); err != nil {
+		return nil, err
+	}
 	return b.tx.txn.Stat(b.dbi)
 }
 
+// ForEach executes a function for each key/value pair in the bucket.
+// Deleting the current key from within the function is safe and does not skip any items.
+// If the provided function returns an error then the iteration is stopped and the error is returned.
 func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
 	c, err := b.Cursor()
 	if err != nil {
@@ -83,5 +372,67 @@ func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
 			return err
 		}
 	}
-	return nil
+	return b.tx.ctx.Err()
+}
+
+// Range executes a function for each key/value pair with a key between start and end, inclusive.
+// The keys are visited in ascending order, or in descending order if reverse is true.
+// A nil start or end leaves that side of the range unbounded.
+// If the provided function returns an error then the iteration is stopped and the error is returned.
+func (b *Bucket) Range(start, end []byte, reverse bool, fn func(k, v []byte) error) error {
+	c, err := b.Cursor()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if reverse {
+		return b.rangeReverse(c, start, end, fn)
+	}
+	var k, v []byte
+	if start == nil {
+		k, v = c.First()
+	} else {
+		k, v = c.Seek(start)
+	}
+	for ; k != nil; k, v = c.Next() {
+		if end != nil && b.compare(k, end) > 0 {
+			break
+		}
+		if err = fn(k, v); err != nil {
+			return err
+		}
+	}
+	return b.tx.ctx.Err()
+}
+
+func (b *Bucket) rangeReverse(c *Cursor, start, end []byte, fn func(k, v []byte) error) error {
+	for k, v := b.seekLast(c, end); k != nil; k, v = c.Prev() {
+		if start != nil && b.compare(k, start) < 0 {
+			break
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return b.tx.ctx.Err()
+}
+
+// seekLast moves the cursor to the last key that is less than or equal to end,
+// or to the last key of the bucket if end is nil.
+func (b *Bucket) seekLast(c *Cursor, end []byte) (key, val []byte) {
+	if end == nil {
+		return c.Last()
+	}
+	if key, val = c.Seek(end); key == nil {
+		return c.Last()
+	} else if b.compare(key, end) > 0 {
+		return c.Prev()
+	}
+	return key, val
+}
+
+// compare orders two keys the same way the bucket stores them,
+// according to its flags, i.e. INTEGERKEY or REVERSEKEY, and its comparator.
+func (b *Bucket) compare(x, y []byte) int {
+	return b.tx.txn.Cmp(b.dbi, x, y)
 }
@@ -0,0 +1,344 @@
+package bmdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDupSortBucket(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		vals := [][]byte{[]byte("3"), []byte("1"), []byte("2")}
+		assert.NoError(db.Update(func(tx *Tx) error {
+			_, err := tx.CreateBucketWithOptions(BAR, BucketOptions{Flags: DUPFIXED})
+			assert.Equal(ErrInvalidFlags, err)
+			_, err = tx.CreateBucketWithOptions(BAR, BucketOptions{Flags: BucketFlag(NOSYNC)})
+			assert.Equal(ErrInvalidFlags, err)
+			b, err := tx.CreateBucketWithOptions(FOO, BucketOptions{Flags: DUPSORT})
+			if err != nil {
+				return err
+			}
+			for _, v := range vals {
+				if err := b.PutDup(FOO, v); err != nil {
+					return err
+				}
+			}
+			if err := b.PutDup(FOO, vals[0]); err != nil {
+				return err
+			}
+			if err := b.PutDup(BAR, vals[0]); err != nil {
+				return err
+			}
+			plain, err := tx.CreateBucket(BAR)
+			if err != nil {
+				return err
+			}
+			assert.Equal(ErrNotDupSort, plain.PutDup(FOO, BAR))
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			assert.Equal([][]byte{[]byte("1"), []byte("2"), []byte("3")}, b.GetAll(FOO))
+			n, err := b.CountDups(FOO)
+			assert.NoError(err)
+			assert.Equal(uint64(3), n)
+			n, err = b.CountDups([]byte("missing"))
+			assert.NoError(err)
+			assert.Equal(uint64(0), n)
+
+			c, err := b.Cursor()
+			if err != nil {
+				return err
+			}
+			k, v := c.SeekBoth(FOO, []byte("2"))
+			assert.Equal(FOO, k)
+			assert.Equal([]byte("2"), v)
+			_, v = c.NextDup()
+			assert.Equal([]byte("3"), v)
+			k, _ = c.NextDup()
+			assert.Nil(k)
+			_, v = c.FirstDup()
+			assert.Equal([]byte("1"), v)
+			k, _ = c.Seek(BAR)
+			assert.Equal(BAR, k)
+			k, v = c.NextNoDup()
+			assert.Equal(FOO, k)
+			assert.Equal([]byte("1"), v)
+			k, _ = c.SeekBoth(FOO, []byte("4"))
+			assert.Nil(k)
+			return nil
+		}))
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			if err := b.DeleteDup(FOO, []byte("2")); err != nil {
+				return err
+			}
+			assert.Equal([][]byte{[]byte("1"), []byte("3")}, b.GetAll(FOO))
+			if err := b.Delete(FOO); err != nil {
+				return err
+			}
+			assert.Nil(b.GetAll(FOO))
+			return nil
+		}))
+	})
+}
+
+func TestBucketSequence(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		errRollback := errors.New("rollback")
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucket(FOO)
+			if err != nil {
+				return err
+			}
+			for i := uint64(1); i <= 3; i++ {
+				seq, err := b.NextSequence()
+				assert.NoError(err)
+				assert.Equal(i, seq)
+			}
+			_, err = tx.CreateBucket([]byte(metaBucketName))
+			assert.Equal(ErrReservedName, err)
+			return nil
+		}))
+		assert.Equal(errRollback, db.Update(func(tx *Tx) error {
+			seq, err := tx.Bucket(FOO).NextSequence()
+			assert.NoError(err)
+			assert.Equal(uint64(4), seq)
+			return errRollback
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			assert.Equal(uint64(3), b.Sequence())
+			_, err := b.NextSequence()
+			assert.Equal(ErrTxNotWritable, err)
+			assert.Nil(tx.Bucket([]byte(metaBucketName)))
+			var names []string
+			assert.NoError(tx.BucketNames().ForEach(func(k, _ []byte) error {
+				names = append(names, string(k))
+				return nil
+			}))
+			assert.Equal([]string{string(FOO)}, names)
+			return nil
+		}))
+		assert.NoError(db.Update(func(tx *Tx) error {
+			if err := tx.DeleteBucket(FOO); err != nil {
+				return err
+			}
+			b, err := tx.CreateBucket(FOO)
+			if err != nil {
+				return err
+			}
+			assert.Equal(uint64(0), b.Sequence())
+			return b.SetSequence(10)
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal(uint64(10), tx.Bucket(FOO).Sequence())
+			return nil
+		}))
+
+		// the bucket doesn't follow the caller's buffer once it's reused for another name
+		assert.NoError(db.Update(func(tx *Tx) error {
+			name := []byte("bar")
+			b, err := tx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+			copy(name, FOO)
+			_, err = b.NextSequence()
+			return err
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal(uint64(10), tx.Bucket(FOO).Sequence())
+			assert.Equal(uint64(1), tx.Bucket(BAR).Sequence())
+			return nil
+		}))
+	})
+}
+
+func TestNoCopy(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal([]byte("a2"), tx.Bucket(FOO).GetNoCopy([]byte("a2")))
+			return nil
+		}))
+	})
+}
+
+func TestNoCopyDebug(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{DebugNoCopy: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	if !assert.NoError(fillBucket(db, FOO)) {
+		return
+	}
+	var retained []byte
+	assert.NoError(db.View(func(tx *Tx) error {
+		b := tx.Bucket(FOO)
+		assert.Equal([]byte("b1"), b.GetNoCopy([]byte("b1")))
+		assert.Nil(b.GetNoCopy([]byte("missing")))
+		c, err := b.Cursor()
+		if err != nil {
+			return err
+		}
+		c.SetNoCopy(true)
+		k, v := c.Seek([]byte("c"))
+		assert.Equal([]byte("c1"), k)
+		assert.Equal([]byte("c1"), v)
+		retained = v
+		return nil
+	}))
+	assert.Equal([]byte{poisonByte, poisonByte}, retained)
+
+	// the values read by a writable transaction are copies, they survive the updates
+	assert.NoError(db.Update(func(tx *Tx) error {
+		b := tx.Bucket(FOO)
+		retained = b.GetNoCopy([]byte("a1"))
+		return b.Put([]byte("a1"), []byte("zz"))
+	}))
+	assert.Equal([]byte("a1"), retained)
+}
+
+func TestPutReserve(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		errEncode := errors.New("encode")
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucket(FOO)
+			if err != nil {
+				return err
+			}
+			if err = b.PutReserve(FOO, len(BAR), func(buf []byte) error {
+				assert.Len(buf, len(BAR))
+				copy(buf, BAR)
+				return nil
+			}); err != nil {
+				return err
+			}
+			assert.Equal(errEncode, b.PutReserve(BAR, 8, func([]byte) error {
+				return errEncode
+			}))
+			dups, err := tx.CreateBucketWithOptions(BAR, BucketOptions{Flags: DUPSORT})
+			if err != nil {
+				return err
+			}
+			assert.Equal(ErrReserveDupSort, dups.PutReserve(FOO, 8, func([]byte) error {
+				return nil
+			}))
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal(BAR, tx.Bucket(FOO).Get(FOO))
+			return nil
+		}))
+	})
+}
+
+func TestNestedBuckets(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		assert.NoError(db.Update(func(tx *Tx) error {
+			parent, err := tx.CreateBucket(FOO)
+			if err != nil {
+				return err
+			}
+			child, err := parent.CreateBucket(BAR)
+			if err != nil {
+				return err
+			}
+			if err = child.Put(FOO, BAR); err != nil {
+				return err
+			}
+			grandchild, err := child.CreateBucketIfNotExists(FOO)
+			if err != nil {
+				return err
+			}
+			if err = grandchild.Put(BAR, FOO); err != nil {
+				return err
+			}
+			if _, err = parent.CreateBucketIfNotExists([]byte("other")); err != nil {
+				return err
+			}
+			_, err = parent.CreateBucket(BAR)
+			assert.Equal(ErrBucketExists, err)
+			_, err = parent.CreateBucket([]byte{'a', bucketSeparator})
+			assert.Equal(ErrInvalidName, err)
+			_, err = tx.CreateBucket([]byte{bucketSeparator})
+			assert.Equal(ErrInvalidName, err)
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			child := tx.Bucket(FOO).Bucket(BAR)
+			assert.NotNil(child)
+			assert.Equal(BAR, child.Get(FOO))
+			assert.Equal(FOO, child.Bucket(FOO).Get(BAR))
+			assert.Nil(tx.Bucket(FOO).Bucket(FOO))
+
+			var names []string
+			assert.NoError(tx.Bucket(FOO).ForEachBucket(func(name []byte) error {
+				names = append(names, string(name))
+				return nil
+			}))
+			assert.Equal([]string{"bar", "other"}, names)
+
+			names = names[:0]
+			assert.NoError(tx.BucketNames().ForEach(func(k, _ []byte) error {
+				names = append(names, string(k))
+				return nil
+			}))
+			assert.Equal([]string{"foo"}, names)
+			return nil
+		}))
+		assert.NoError(db.Update(func(tx *Tx) error {
+			return tx.DeleteBucket(FOO)
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Nil(tx.Bucket(FOO))
+			assert.Nil(tx.openBucket(nestedName(FOO, BAR)))
+			assert.Nil(tx.openBucket(nestedName(nestedName(FOO, BAR), FOO)))
+			return nil
+		}))
+	})
+}
+
+func TestNestedBucketOptions(t *testing.T) {
+	assert := assert.New(t)
+	// the metadata bucket and two other buckets
+	db, err := getDBWithOptions(&Options{MaxBuckets: 3})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.Update(func(tx *Tx) error {
+		parent, err := tx.CreateBucket(FOO)
+		if err != nil {
+			return err
+		}
+		child, err := parent.CreateBucketWithOptions(BAR, BucketOptions{Flags: DUPSORT})
+		if err != nil {
+			return err
+		}
+		assert.True(child.dupSort())
+		_, err = parent.CreateBucketWithOptions(FOO, BucketOptions{Flags: DUPFIXED})
+		assert.Equal(ErrInvalidFlags, err)
+		_, err = parent.CreateBucket(FOO)
+		assert.Equal(ErrTooManyBuckets, err)
+		return nil
+	}))
+	assert.NoError(db.View(func(tx *Tx) error {
+		child := tx.Bucket(FOO).Bucket(BAR)
+		if assert.NotNil(child) {
+			assert.True(child.dupSort())
+		}
+		return nil
+	}))
+}
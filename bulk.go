@@ -0,0 +1,113 @@
+package bmdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/missionMeteora/bmdb/mdb"
+)
+
+// DefaultBulkBatchSize is the number of records committed at once by BulkLoad when no batch size is given.
+const DefaultBulkBatchSize = 10000
+
+type kv struct {
+	key, val []byte
+}
+
+// BulkLoad writes the key/value pairs returned by next into the named bucket, creating it if needed.
+// The pairs must be sorted by key, and by value for the same key in a DUPSORT bucket, so they can be
+// appended to the bucket, which is much faster than inserting them at random.
+// The next function returns a nil key once there are no more pairs, the returned slices are held
+// until their batch is committed and must not be reused by next in the meantime.
+//
+// The pairs are committed every batchSize records, or DefaultBulkBatchSize if batchSize is not positive,
+// which bounds the size of the transactions. A failure leaves the already committed batches in place.
+// Returns the number of committed pairs, and an error wrapping ErrKeyOutOfOrder when a pair is out of order.
+func (db *DB) BulkLoad(name []byte, batchSize int, next func() (key, val []byte, err error)) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+	var (
+		n     int
+		prev  []byte
+		batch = make([]kv, 0, batchSize)
+	)
+	for {
+		batch = batch[:0]
+		for len(batch) < batchSize {
+			k, v, err := next()
+			if err != nil {
+				return n, err
+			} else if k == nil {
+				break
+			}
+			batch = append(batch, kv{k, v})
+		}
+		if len(batch) == 0 {
+			return n, nil
+		}
+		last := prev
+		err := db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			// the batch may be retried, e.g. when the map has to grow
+			last = prev
+			if last == nil {
+				// the first pair may be a duplicate of the last key already in the bucket
+				if last, err = b.lastKey(); err != nil {
+					return err
+				}
+			}
+			for _, p := range batch {
+				if err := b.append(p.key, p.val, last); err != nil {
+					return err
+				}
+				last = p.key
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		n += len(batch)
+		// next may reuse the slices of the committed batch
+		prev = bytes.Clone(last)
+		if len(batch) < batchSize {
+			return n, nil
+		}
+	}
+}
+
+// lastKey returns the last key of the bucket, or nil if the bucket is empty.
+func (b *Bucket) lastKey() ([]byte, error) {
+	c, err := b.Cursor()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	k, _ := c.Last()
+	return k, nil
+}
+
+// append writes a key/value pair at the end of the bucket, prev is the last appended key.
+func (b *Bucket) append(key, val, prev []byte) error {
+	if err := b.tx.check(); err != nil {
+		return err
+	} else if !b.tx.Writable() {
+		return ErrTxNotWritable
+	}
+	var flags uint = mdb.APPEND
+	if b.dupSort() {
+		flags = mdb.APPENDDUP
+		if !bytes.Equal(key, prev) {
+			flags |= mdb.APPEND
+		}
+	}
+	err := b.tx.txn.Put(b.dbi, key, val, flags)
+	if err == mdb.KeyExist {
+		return fmt.Errorf("%w: %q", ErrKeyOutOfOrder, key)
+	}
+	return wrapError("put", b.name, err)
+}
@@ -0,0 +1,89 @@
+package bmdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func counter(from, to int) func() ([]byte, []byte, error) {
+	return func() ([]byte, []byte, error) {
+		if from >= to {
+			return nil, nil, nil
+		}
+		k := []byte(fmt.Sprintf("%06d", from))
+		from++
+		return k, k, nil
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		n, err := db.BulkLoad(FOO, 100, counter(0, 250))
+		assert.NoError(err)
+		assert.Equal(250, n)
+		n, err = db.BulkLoad(FOO, 100, counter(250, 300))
+		assert.NoError(err)
+		assert.Equal(50, n)
+
+		n, err = db.BulkLoad(FOO, 100, counter(100, 200))
+		assert.True(errors.Is(err, ErrKeyOutOfOrder))
+		assert.Equal(0, n)
+
+		assert.NoError(db.Update(func(tx *Tx) error {
+			_, err := tx.CreateBucketWithOptions(BAR, BucketOptions{Flags: DUPSORT})
+			return err
+		}))
+		pairs := func(pairs ...string) func() ([]byte, []byte, error) {
+			return func() ([]byte, []byte, error) {
+				if len(pairs) == 0 {
+					return nil, nil, nil
+				}
+				k, v := pairs[0], pairs[1]
+				pairs = pairs[2:]
+				return []byte(k), []byte(v), nil
+			}
+		}
+		n, err = db.BulkLoad(BAR, 0, pairs("a", "1", "a", "2", "b", "1", "b", "0"))
+		assert.True(errors.Is(err, ErrKeyOutOfOrder))
+		n, err = db.BulkLoad(BAR, 0, pairs("c", "1", "c", "2", "d", "1"))
+		assert.NoError(err)
+		assert.Equal(3, n)
+		// the values of the last key of the bucket can be continued
+		n, err = db.BulkLoad(BAR, 0, pairs("d", "2"))
+		assert.NoError(err)
+		assert.Equal(1, n)
+
+		// next reuses the key buffers of the committed batches
+		keys := []string{"e", "f", "f", "g"}
+		bufs := [][]byte{make([]byte, 1), make([]byte, 1)}
+		i := 0
+		n, err = db.BulkLoad(BAR, 2, func() ([]byte, []byte, error) {
+			if i == len(keys) {
+				return nil, nil, nil
+			}
+			k := bufs[i%2]
+			copy(k, keys[i])
+			i++
+			return k, []byte(fmt.Sprint(i)), nil
+		})
+		assert.NoError(err)
+		assert.Equal(4, n)
+
+		assert.NoError(db.View(func(tx *Tx) error {
+			stats, err := tx.Bucket(FOO).Stats()
+			if err != nil {
+				return err
+			}
+			assert.Equal(uint64(300), stats.Entries)
+			assert.Nil(tx.Bucket(BAR).Get([]byte("a")))
+			assert.Equal([][]byte{[]byte("1"), []byte("2")}, tx.Bucket(BAR).GetAll([]byte("c")))
+			assert.Equal([][]byte{[]byte("1"), []byte("2")}, tx.Bucket(BAR).GetAll([]byte("d")))
+			assert.Equal([][]byte{[]byte("2"), []byte("3")}, tx.Bucket(BAR).GetAll([]byte("f")))
+			return nil
+		}))
+	})
+}
@@ -1,6 +1,7 @@
 package bmdb
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/missionMeteora/bmdb/mdb"
@@ -17,39 +18,141 @@ const (
 	MaxValueSize = 4294967295
 )
 
+// bucketSeparator joins the names of the nested buckets into the name of their database,
+// i.e. the bucket "b" nested in "a" is stored as "a\x1fb". Bucket names must not contain it.
+const bucketSeparator = 0x1f
+
+// maxFullNameLength is the maximum length of the full name of a nested bucket, in bytes.
+// The names are keys of the main database, so they share the LMDB key size limit.
+const maxFullNameLength = 511
+
 var DefaultBucketName = []byte("default")
 
 var (
-	ErrKeyTooLarge     = errors.New("key is too large")
-	ErrValueTooLarge   = errors.New("value is too large")
-	ErrBucketExists    = errors.New("bucket already exists")
-	ErrNameTooLong     = errors.New("bucket name is too long")
-	ErrNoBucketName    = errors.New("no bucket name provided")
-	ErrBucketNotFound  = errors.New("bucket not found")
-	ErrKeyRequired     = errors.New("key is required")
-	ErrTxManaged       = errors.New("this transaction is managed")
-	ErrTxDone          = errors.New("this transaction is done")
-	ErrDatabaseNotOpen = errors.New("database not open")
-	ErrTxNotWritable   = errors.New("read-only transaction")
+	ErrKeyTooLarge         = errors.New("key is too large")
+	ErrValueTooLarge       = errors.New("value is too large")
+	ErrBucketExists        = errors.New("bucket already exists")
+	ErrNameTooLong         = errors.New("bucket name is too long")
+	ErrNoBucketName        = errors.New("no bucket name provided")
+	ErrReservedName        = errors.New("bucket name is reserved")
+	ErrInvalidName         = errors.New("bucket name contains an invalid character")
+	ErrBucketNotFound      = errors.New("bucket not found")
+	ErrTooManyBuckets      = errors.New("too many buckets, see Options.MaxBuckets")
+	ErrKeyRequired         = errors.New("key is required")
+	ErrTxManaged           = errors.New("this transaction is managed")
+	ErrTxDone              = errors.New("this transaction is done")
+	ErrDatabaseNotOpen     = errors.New("database not open")
+	ErrDatabaseReadOnly    = errors.New("database is opened in read-only mode")
+	ErrTxNotWritable       = errors.New("read-only transaction")
+	ErrNestedTxUnsupported = errors.New("nested transactions are not supported with WRITEMAP")
+	ErrInvalidFlags        = errors.New("invalid bucket flags")
+	ErrInvalidEnvFlags     = errors.New("invalid environment flags")
+	ErrNotDupSort          = errors.New("bucket does not support duplicate values")
+	ErrReserveDupSort      = errors.New("cannot reserve values in a DUPSORT bucket")
+	ErrKeyOutOfOrder       = errors.New("key is out of order")
+
+	ErrNoComparatorName  = errors.New("no comparator name provided")
+	ErrComparatorExists  = errors.New("comparator already registered")
+	ErrUnknownComparator = errors.New("comparator is not registered")
 )
 
+// EnvFlag is a flag of the environment, set in Options.Flags.
 type EnvFlag uint
 
 const (
 	FIXEDMAP   EnvFlag = mdb.FIXEDMAP   // mmap at a fixed address (experimental)
 	NOSUBDIR   EnvFlag = mdb.NOSUBDIR   // no environment directory
 	NOSYNC     EnvFlag = mdb.NOSYNC     // don't fsync after commit
-	RDONLY     EnvFlag = mdb.RDONLY     // read only
+	RDONLY     EnvFlag = mdb.RDONLY     // read only, same as Options.ReadOnly
 	NOMETASYNC EnvFlag = mdb.NOMETASYNC // don't fsync metapage after commit
 	WRITEMAP   EnvFlag = mdb.WRITEMAP   // use writable mmap
 	MAPASYNC   EnvFlag = mdb.MAPASYNC   // use asynchronous msync when MDB_WRITEMAP is use
 	NOTLS      EnvFlag = mdb.NOTLS      // tie reader locktable slots to Txn objects instead of threads
-	//
-	REVERSEKEY EnvFlag = mdb.REVERSEKEY // use reverse string keys
-	DUPSORT    EnvFlag = mdb.DUPSORT    // use sorted duplicates
-	INTEGERKEY EnvFlag = mdb.INTEGERKEY // numeric keys in native byte order. The keys must all be of the same size.
-	DUPFIXED   EnvFlag = mdb.DUPFIXED   // with DUPSORT, sorted dup items have fixed size
-	INTEGERDUP EnvFlag = mdb.INTEGERDUP // with DUPSORT, dups are numeric in native byte order
-	REVERSEDUP EnvFlag = mdb.REVERSEDUP // with DUPSORT, use reverse string dups
-	CREATE     EnvFlag = mdb.CREATE     // create DB if not already existing
+	NOLOCK     EnvFlag = mdb.NOLOCK     // don't do any locking, caller must manage their own locks
+	NORDAHEAD  EnvFlag = mdb.NORDAHEAD  // don't do readahead (no effect on Windows)
+	NOMEMINIT  EnvFlag = mdb.NOMEMINIT  // don't initialize malloc'd memory before writing to datafile
+)
+
+// BucketFlag is a flag of a bucket, set in BucketOptions.Flags.
+type BucketFlag uint
+
+const (
+	REVERSEKEY BucketFlag = mdb.REVERSEKEY // use reverse string keys
+	DUPSORT    BucketFlag = mdb.DUPSORT    // use sorted duplicates
+	INTEGERKEY BucketFlag = mdb.INTEGERKEY // numeric keys in native byte order. The keys must all be of the same size.
+	DUPFIXED   BucketFlag = mdb.DUPFIXED   // with DUPSORT, sorted dup items have fixed size
+	INTEGERDUP BucketFlag = mdb.INTEGERDUP // with DUPSORT, dups are numeric in native byte order
+	REVERSEDUP BucketFlag = mdb.REVERSEDUP // with DUPSORT, use reverse string dups
+	CREATE     BucketFlag = mdb.CREATE     // create DB if not already existing, implied by CreateBucket so it's ignored
 )
+
+// envFlags are the flags that can be used with Options.
+const envFlags = FIXEDMAP | NOSUBDIR | NOSYNC | RDONLY | NOMETASYNC | WRITEMAP | MAPASYNC | NOTLS |
+	NOLOCK | NORDAHEAD | NOMEMINIT
+
+// rdonlyFlags are the flags that make no sense for a read-only environment.
+const rdonlyFlags = NOSYNC | NOMETASYNC | WRITEMAP | MAPASYNC | NOMEMINIT
+
+// checkName validates the name of a bucket, which for a nested bucket is the name within its parent.
+func checkName(name []byte) error {
+	if len(name) == 0 {
+		return ErrNoBucketName
+	} else if len(name) > MaxNameLength {
+		return ErrNameTooLong
+	} else if isReservedName(name) {
+		return ErrReservedName
+	} else if bytes.IndexByte(name, bucketSeparator) >= 0 {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// nestedName returns the full name of a bucket nested in the parent bucket.
+func nestedName(parent, name []byte) []byte {
+	full := make([]byte, 0, len(parent)+1+len(name))
+	full = append(full, parent...)
+	full = append(full, bucketSeparator)
+	return append(full, name...)
+}
+
+// bucketFlags are the flags that can be used with BucketOptions.
+const bucketFlags = REVERSEKEY | DUPSORT | INTEGERKEY | DUPFIXED | INTEGERDUP | REVERSEDUP
+
+// dupFlags are the flags that are only valid along with DUPSORT.
+const dupFlags = DUPFIXED | INTEGERDUP | REVERSEDUP
+
+// BucketOptions represents the options that can be set when creating a bucket.
+type BucketOptions struct {
+	// Flags are the flags the bucket is created with, e.g. DUPSORT to store multiple values per key.
+	// Only REVERSEKEY, DUPSORT, INTEGERKEY, DUPFIXED, INTEGERDUP and REVERSEDUP are allowed,
+	// DUPFIXED, INTEGERDUP and REVERSEDUP require DUPSORT. CREATE is accepted but ignored.
+	Flags BucketFlag
+	// Comparator is the name of the registered comparator that orders the keys of the bucket.
+	Comparator string
+	// DupComparator is the name of the registered comparator that orders the values of a DUPSORT bucket.
+	DupComparator string
+	// Codec is the name of the codec of the values, it's only recorded in the metadata of the bucket
+	// for the applications to find out how to decode them, see Bucket.Info.
+	Codec string
+}
+
+func (opts BucketOptions) validate() error {
+	if opts.Flags&^(bucketFlags|CREATE) != 0 {
+		return ErrInvalidFlags
+	} else if opts.Flags&dupFlags != 0 && opts.Flags&DUPSORT == 0 {
+		return ErrInvalidFlags
+	} else if len(opts.DupComparator) > 0 && opts.Flags&DUPSORT == 0 {
+		return ErrNotDupSort
+	}
+	for _, name := range []string{opts.Comparator, opts.DupComparator} {
+		if len(name) > 0 && lookupComparator(name) == nil {
+			return ErrUnknownComparator
+		}
+	}
+	return nil
+}
+
+// hasComparators returns whether the options need to be applied every time the bucket is opened.
+func (opts BucketOptions) hasComparators() bool {
+	return len(opts.Comparator) > 0 || len(opts.DupComparator) > 0
+}
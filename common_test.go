@@ -35,6 +35,10 @@ func getID() int {
 }
 
 func getDB() (*DB, error) {
+	return getDBWithOptions(nil)
+}
+
+func getDBWithOptions(opts *Options) (*DB, error) {
 	path := filepath.Join(TEST_DIR, fmt.Sprintf("%04d.db", getID()))
-	return Open(path, 0644, nil)
+	return Open(path, 0644, opts)
 }
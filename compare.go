@@ -0,0 +1,69 @@
+package bmdb
+
+import (
+	"sync"
+
+	"github.com/missionMeteora/bmdb/mdb"
+)
+
+// comparator is a comparison function registered under a name.
+type comparator struct {
+	cmp mdb.Cmp
+}
+
+var (
+	// A global protected registry of the comparators.
+	cmpMux      sync.RWMutex
+	comparators = make(map[string]*comparator)
+)
+
+// RegisterComparator registers a comparison function under a name, so that buckets can be ordered by it
+// through BucketOptions. The function returns a negative number if a sorts before b, zero if they are equal
+// and a positive number if a sorts after b. The same function must be registered under the same name
+// every time the database is used, and at most mdb.MaxCmpFuncs functions can be registered.
+func RegisterComparator(name string, fn func(a, b []byte) int) error {
+	if len(name) == 0 {
+		return ErrNoComparatorName
+	}
+	cmpMux.Lock()
+	defer cmpMux.Unlock()
+	if _, ok := comparators[name]; ok {
+		return ErrComparatorExists
+	}
+	cmp, err := mdb.RegisterCmpFunc(fn)
+	if err != nil {
+		return err
+	}
+	comparators[name] = &comparator{cmp: cmp}
+	return nil
+}
+
+func lookupComparator(name string) *comparator {
+	cmpMux.RLock()
+	c := comparators[name]
+	cmpMux.RUnlock()
+	return c
+}
+
+// setComparators applies the comparators of the options to a bucket.
+func (tx *Tx) setComparators(dbi mdb.DBI, opts BucketOptions) error {
+	if len(opts.Comparator) > 0 {
+		c := lookupComparator(opts.Comparator)
+		if c == nil {
+			return ErrUnknownComparator
+		}
+		if err := tx.txn.SetCompare(dbi, c.cmp); err != nil {
+			return err
+		}
+	}
+	if len(opts.DupComparator) > 0 {
+		c := lookupComparator(opts.DupComparator)
+		if c == nil {
+			return ErrUnknownComparator
+		}
+		if err := tx.txn.SetDupSort(dbi, c.cmp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package bmdb
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/missionMeteora/bmdb/mdb"
+	"github.com/stretchr/testify/assert"
+)
+
+var registerReverse sync.Once
+
+func reverseComparator(t *testing.T) string {
+	registerReverse.Do(func() {
+		assert.NoError(t, RegisterComparator("reverse", func(a, b []byte) int {
+			return bytes.Compare(b, a)
+		}))
+	})
+	return "reverse"
+}
+
+func TestBucketComparator(t *testing.T) {
+	assert := assert.New(t)
+	opts := BucketOptions{Comparator: reverseComparator(t)}
+	assert.Equal(ErrComparatorExists, RegisterComparator(opts.Comparator, bytes.Compare))
+	_, err := getDBWithOptions(&Options{Buckets: map[string]BucketOptions{"x": {Comparator: "missing"}}})
+	assert.Equal(ErrUnknownComparator, err)
+
+	db, err := getDB()
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucketWithOptions(FOO, opts)
+		if err != nil {
+			return err
+		}
+		for _, k := range testKeys {
+			if err := b.Put(k, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	assert.NoError(db.Close())
+
+	db, err = Open(db.Path(), 0644, &Options{Buckets: map[string]BucketOptions{string(FOO): opts}})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.View(func(tx *Tx) error {
+		b := tx.Bucket(FOO)
+		assert.Equal([]byte("b1"), b.Get([]byte("b1")))
+		keys, err := collectRange(b, nil, nil, false)
+		assert.NoError(err)
+		assert.Equal([]string{"c1", "b2", "b1", "a2", "a1"}, keys)
+		keys, err = collectRange(b, []byte("b2"), []byte("a2"), false)
+		assert.NoError(err)
+		assert.Equal([]string{"b2", "b1", "a2"}, keys)
+		return nil
+	}))
+}
+
+func TestBucketInfo(t *testing.T) {
+	assert := assert.New(t)
+	opts := BucketOptions{
+		Flags:         DUPSORT,
+		Comparator:    reverseComparator(t),
+		DupComparator: reverseComparator(t),
+		Codec:         "json",
+	}
+	db, err := getDB()
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucketWithOptions(FOO, opts)
+		if err != nil {
+			return err
+		}
+		for _, k := range testKeys {
+			if err := b.PutDup(FOO, k); err != nil {
+				return err
+			}
+			if err := b.Put(k, k); err != nil {
+				return err
+			}
+		}
+		// CREATE is implied, so it is neither rejected nor recorded
+		_, err = tx.CreateBucketWithOptions(BAR, BucketOptions{Flags: CREATE})
+		return err
+	}))
+	assert.NoError(db.Close())
+
+	// the options are restored from the metadata without Options.Buckets
+	db, err = Open(db.Path(), 0644, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.View(func(tx *Tx) error {
+		b := tx.Bucket(FOO)
+		info, err := b.Info()
+		if assert.NoError(err) && assert.NotNil(info) {
+			assert.Equal(opts, info.options())
+			assert.False(info.Created.IsZero())
+		}
+		assert.True(b.dupSort())
+		assert.Equal([]string{"foo", "foo", "foo", "foo", "foo", "c1", "b2", "b1", "a2", "a1"}, collectKeys(b.All()))
+		vals := b.GetAll(FOO)
+		if assert.Len(vals, len(testKeys)) {
+			assert.Equal([]byte("c1"), vals[0])
+		}
+
+		info, err = tx.Bucket(BAR).Info()
+		assert.NoError(err)
+		assert.Equal(BucketFlag(0), info.Flags)
+
+		var names []string
+		assert.NoError(tx.BucketNames().ForEach(func(k, _ []byte) error {
+			names = append(names, string(k))
+			return nil
+		}))
+		assert.Equal([]string{"bar", "foo"}, names)
+		return nil
+	}))
+	assert.NoError(db.Update(func(tx *Tx) error {
+		return tx.DeleteBucket(FOO)
+	}))
+	assert.NoError(db.View(func(tx *Tx) error {
+		info, err := tx.bucketInfo(FOO)
+		assert.NoError(err)
+		assert.Nil(info)
+		return nil
+	}))
+}
+
+func TestBucketComparatorDiscarded(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		opts := BucketOptions{Comparator: reverseComparator(t)}
+		errRollback := errors.New("rollback")
+		// createPlain creates the bucket without a record, like an older version or another process would
+		createPlain := func() {
+			assert.NoError(db.Update(func(tx *Tx) error {
+				dbi, err := tx.openDBI(string(FOO), mdb.CREATE)
+				if err != nil {
+					return err
+				}
+				for _, k := range testKeys {
+					if err := tx.txn.Put(dbi, k, k, 0); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+		}
+		checkPlain := func() {
+			assert.NoError(db.View(func(tx *Tx) error {
+				b := tx.Bucket(FOO)
+				assert.Equal(testKeys[0], b.Get(testKeys[0]))
+				assert.Equal([]string{"a1", "a2", "b1", "b2", "c1"}, collectKeys(b.All()))
+				return nil
+			}))
+		}
+
+		// the comparator of a bucket whose creation is rolled back is not kept
+		assert.Equal(errRollback, db.Update(func(tx *Tx) error {
+			if _, err := tx.CreateBucketWithOptions(FOO, opts); err != nil {
+				return err
+			}
+			return errRollback
+		}))
+		createPlain()
+		checkPlain()
+
+		// nor the comparator of a deleted bucket
+		assert.NoError(db.Update(func(tx *Tx) error {
+			if err := tx.DeleteBucket(FOO); err != nil {
+				return err
+			}
+			_, err := tx.CreateBucketWithOptions(FOO, opts)
+			return err
+		}))
+		assert.NoError(db.Update(func(tx *Tx) error {
+			return tx.DeleteBucket(FOO)
+		}))
+		createPlain()
+		checkPlain()
+	})
+}
@@ -4,28 +4,162 @@ import (
 	"github.com/missionMeteora/bmdb/mdb"
 )
 
-type Cursor mdb.Cursor
+// Cursor represents an iterator that can traverse over the key/value pairs of a bucket in sorted order.
+// In a writable transaction the cursor can also update or delete the item it points to.
+type Cursor struct {
+	tx     *Tx
+	cursor *mdb.Cursor
+	slot   cursorSlot
+	bucket []byte
+	// names is set for the cursors over Tx.BucketNames, they skip the internal and nested buckets.
+	names  bool
+	noCopy bool
+}
 
+// Close closes the cursor. The cursors still open when the transaction ends are closed along with it,
+// closing them again has no effect.
 func (c *Cursor) Close() error {
-	return (*mdb.Cursor)(c).Close()
+	return c.tx.closeCursor(c)
+}
+
+// SetNoCopy enables or disables the zero-copy mode of the cursor.
+// In zero-copy mode the returned keys and values point directly into the memory map:
+// they must not be modified and are only valid until the transaction is closed.
+// The mode has no effect in a writable transaction, since LMDB only keeps them valid until the next update.
+func (c *Cursor) SetNoCopy(noCopy bool) {
+	c.noCopy = noCopy
 }
 
 func (c *Cursor) First() (key, val []byte) {
-	key, val, _ = (*mdb.Cursor)(c).Get(nil, nil, mdb.FIRST)
-	return
+	return c.get(nil, nil, mdb.FIRST)
 }
 
 func (c *Cursor) Last() (key, val []byte) {
-	key, val, _ = (*mdb.Cursor)(c).Get(nil, nil, mdb.LAST)
-	return
+	return c.get(nil, nil, mdb.LAST)
 }
 
 func (c *Cursor) Next() (key, val []byte) {
-	key, val, _ = (*mdb.Cursor)(c).Get(nil, nil, mdb.NEXT)
-	return
+	return c.get(nil, nil, mdb.NEXT)
 }
 
 func (c *Cursor) Prev() (key, val []byte) {
-	key, val, _ = (*mdb.Cursor)(c).Get(nil, nil, mdb.PREV)
+	return c.get(nil, nil, mdb.PREV)
+}
+
+// Current returns the key and value the cursor currently points to.
+// Returns nil key and value if the cursor is not positioned.
+func (c *Cursor) Current() (key, val []byte) {
+	return c.get(nil, nil, mdb.GET_CURRENT)
+}
+
+// Seek moves the cursor to the first key that is greater than or equal to seek
+// and returns it. Returns nil key and value if there is no such key.
+// An empty seek key moves the cursor to the first item.
+func (c *Cursor) Seek(seek []byte) (key, val []byte) {
+	if len(seek) == 0 {
+		return c.First()
+	}
+	return c.get(seek, nil, mdb.SET_RANGE)
+}
+
+// FirstDup moves the cursor to the first value of the current key and returns it.
+func (c *Cursor) FirstDup() (key, val []byte) {
+	return c.get(nil, nil, mdb.FIRST_DUP)
+}
+
+// LastDup moves the cursor to the last value of the current key and returns it.
+func (c *Cursor) LastDup() (key, val []byte) {
+	return c.get(nil, nil, mdb.LAST_DUP)
+}
+
+// NextDup moves the cursor to the next value of the current key and returns it.
+// Returns nil key and value after the last value of the key.
+func (c *Cursor) NextDup() (key, val []byte) {
+	return c.get(nil, nil, mdb.NEXT_DUP)
+}
+
+// PrevDup moves the cursor to the previous value of the current key and returns it.
+// Returns nil key and value before the first value of the key.
+func (c *Cursor) PrevDup() (key, val []byte) {
+	return c.get(nil, nil, mdb.PREV_DUP)
+}
+
+// NextNoDup moves the cursor to the first value of the next key and returns it.
+func (c *Cursor) NextNoDup() (key, val []byte) {
+	return c.get(nil, nil, mdb.NEXT_NODUP)
+}
+
+// PrevNoDup moves the cursor to the last value of the previous key and returns it.
+func (c *Cursor) PrevNoDup() (key, val []byte) {
+	return c.get(nil, nil, mdb.PREV_NODUP)
+}
+
+// SeekBoth moves the cursor to the exact key/value pair and returns it.
+// Returns nil key and value if the pair does not exist.
+func (c *Cursor) SeekBoth(seekKey, seekVal []byte) (key, val []byte) {
+	return c.get(seekKey, seekVal, mdb.GET_BOTH)
+}
+
+// Count returns the number of values stored for the current key.
+func (c *Cursor) Count() (uint64, error) {
+	if err := c.tx.check(); err != nil {
+		return 0, err
+	}
+	n, err := c.cursor.Count()
+	return n, wrapError("count", c.bucket, err)
+}
+
+// Put stores the value for a key and moves the cursor to it.
+// Returns an error if the transaction is done or is not writable.
+func (c *Cursor) Put(key, val []byte) error {
+	if err := c.tx.check(); err != nil {
+		return err
+	} else if !c.tx.Writable() {
+		return ErrTxNotWritable
+	}
+	return wrapError("put", c.bucket, c.cursor.Put(key, val, 0))
+}
+
+// Delete removes the item the cursor currently points to.
+// The cursor stays in place, so a following call to Next returns the item after the deleted one,
+// which makes it safe to delete items while iterating.
+// Returns an error if the transaction is done or is not writable.
+func (c *Cursor) Delete() error {
+	if err := c.tx.check(); err != nil {
+		return err
+	} else if !c.tx.Writable() {
+		return ErrTxNotWritable
+	}
+	return wrapError("delete", c.bucket, c.cursor.Del(0))
+}
+
+func (c *Cursor) get(setKey, setVal []byte, op uint) (key, val []byte) {
+	if c.tx.check() != nil {
+		return nil, nil
+	}
+	key, val = c.read(setKey, setVal, op)
+	// move past the names hidden from Tx.BucketNames in the direction of op
+	for c.names && key != nil && isHiddenName(key) {
+		switch op {
+		case mdb.FIRST, mdb.NEXT, mdb.NEXT_NODUP, mdb.SET_RANGE:
+			op = mdb.NEXT
+		case mdb.LAST, mdb.PREV, mdb.PREV_NODUP:
+			op = mdb.PREV
+		default:
+			return nil, nil
+		}
+		key, val = c.read(nil, nil, op)
+	}
 	return
 }
+
+func (c *Cursor) read(setKey, setVal []byte, op uint) (key, val []byte) {
+	k, v, err := c.cursor.GetVal(setKey, setVal, op)
+	if err != nil {
+		return nil, nil
+	}
+	if c.noCopy {
+		return c.tx.bytesNoCopy(k), c.tx.bytesNoCopy(v)
+	}
+	return k.Bytes(), v.Bytes()
+}
@@ -0,0 +1,158 @@
+package bmdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKeys = [][]byte{
+	[]byte("a1"), []byte("a2"), []byte("b1"), []byte("b2"), []byte("c1"),
+}
+
+func fillBucket(db *DB, name []byte) error {
+	return db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		for _, k := range testKeys {
+			if err := b.Put(k, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func collectRange(b *Bucket, start, end []byte, reverse bool) (keys []string, err error) {
+	err = b.Range(start, end, reverse, func(k, _ []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	return
+}
+
+func TestCursorSeek(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		assert.NoError(db.View(func(tx *Tx) error {
+			c, err := tx.Bucket(FOO).Cursor()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			k, v := c.Seek([]byte("b"))
+			assert.Equal([]byte("b1"), k)
+			assert.Equal([]byte("b1"), v)
+			k, _ = c.Next()
+			assert.Equal([]byte("b2"), k)
+			k, _ = c.Seek([]byte("c1"))
+			assert.Equal([]byte("c1"), k)
+			k, _ = c.Seek([]byte("d"))
+			assert.Nil(k)
+			k, _ = c.Seek(nil)
+			assert.Equal([]byte("a1"), k)
+			return nil
+		}))
+	})
+}
+
+func TestBucketRange(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		assert.NoError(db.View(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			keys, err := collectRange(b, []byte("a2"), []byte("b2"), false)
+			assert.NoError(err)
+			assert.Equal([]string{"a2", "b1", "b2"}, keys)
+			keys, err = collectRange(b, []byte("a2"), []byte("b"), true)
+			assert.NoError(err)
+			assert.Equal([]string{"a2"}, keys)
+			keys, err = collectRange(b, []byte("b"), nil, false)
+			assert.NoError(err)
+			assert.Equal([]string{"b1", "b2", "c1"}, keys)
+			keys, err = collectRange(b, nil, []byte("z"), true)
+			assert.NoError(err)
+			assert.Equal([]string{"c1", "b2", "b1", "a2", "a1"}, keys)
+			keys, err = collectRange(b, []byte("x"), nil, false)
+			assert.NoError(err)
+			assert.Empty(keys)
+			return nil
+		}))
+	})
+}
+
+func TestCursorPutDeleteCurrent(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		assert.NoError(db.Update(func(tx *Tx) error {
+			c, err := tx.Bucket(FOO).Cursor()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				if k[0] == 'b' {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := c.Put(k, BAR); err != nil {
+					return err
+				}
+				ck, cv := c.Current()
+				assert.Equal(k, ck)
+				assert.Equal(BAR, cv)
+			}
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			c, err := tx.Bucket(FOO).Cursor()
+			if err != nil {
+				return err
+			}
+			assert.Equal(ErrTxNotWritable, c.Put(FOO, BAR))
+			assert.Equal(ErrTxNotWritable, c.Delete())
+			keys, err := collectRange(tx.Bucket(FOO), nil, nil, false)
+			assert.NoError(err)
+			assert.Equal([]string{"a1", "a2", "c1"}, keys)
+			assert.Equal(BAR, tx.Bucket(FOO).Get([]byte("c1")))
+			return nil
+		}))
+	})
+}
+
+func TestBucketDeleteInForEach(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		var seen []string
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			return b.ForEach(func(k, _ []byte) error {
+				seen = append(seen, string(k))
+				return b.Delete(k)
+			})
+		}))
+		assert.Equal([]string{"a1", "a2", "b1", "b2", "c1"}, seen)
+		assert.NoError(db.View(func(tx *Tx) error {
+			keys, err := collectRange(tx.Bucket(FOO), nil, nil, false)
+			assert.NoError(err)
+			assert.Empty(keys)
+			return nil
+		}))
+	})
+}
@@ -1,8 +1,14 @@
 package bmdb
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/missionMeteora/bmdb/mdb"
 )
@@ -12,23 +18,126 @@ type DB struct {
 	env    *mdb.Env
 	opts   *Options
 	closed bool
+	logger *slog.Logger
+
+	// txSeq numbers the transactions, the numbers identify them in the logs.
+	txSeq atomic.Uint64
 
 	// A protected registry of transactions.
 	mux          sync.RWMutex
 	transactions map[*Tx]struct{}
+
+	// mapMux protects the map resizes: openTxs counts the open top-level transactions and copies,
+	// and resizing is set while a resize waits for them to be closed. mapCond is broadcast when either changes.
+	mapMux   sync.Mutex
+	mapCond  *sync.Cond
+	openTxs  int
+	resizing bool
+
+	batchMux sync.Mutex
+	batch    *batch
+
+	// writer is the dedicated writer, if enabled in the options.
+	writer *writer
+
+	// A protected registry of the transaction observers.
+	hooksMux   sync.RWMutex
+	beginHooks []func(*Tx)
+	endHooks   []func(tx *Tx, committed bool)
+
+	// readTxs pools the reset read-only transactions, protected by poolMux.
+	poolMux sync.Mutex
+	readTxs []*readTxn
+
+	// dbis caches the handles of the named buckets once the transaction that opened them is committed,
+	// LMDB keeps them open for the lifetime of the environment until the bucket is dropped.
+	dbiMux sync.RWMutex
+	dbis   map[string]mdb.DBI
+
+	// bucketOpts keeps the options of the buckets with comparators, protected by mux: the ones of Options.Buckets,
+	// and in recordedOpts the ones recorded in the metadata of the buckets once the bucket is committed.
+	// The options of Options.Buckets take precedence over the recorded ones.
+	bucketOpts   map[string]BucketOptions
+	recordedOpts map[string]BucketOptions
 }
 
 type Options struct {
+	// ReadOnly opens an existing database in read-only mode, i.e. one written by another process.
+	// The write transactions fail with ErrDatabaseReadOnly, while the new read transactions see
+	// the updates committed by the other process.
+	//
+	// When another process grows the map, the next transaction to begin adopts the new size,
+	// which waits for all the open transactions to be closed. So in a database shared with other
+	// processes, a goroutine must not begin a transaction while keeping another one open.
+	ReadOnly bool
+
+	// Flags are the flags of the environment, Open fails with ErrInvalidEnvFlags on an invalid combination.
+	// The flags of the buckets are set in BucketOptions instead.
 	Flags      EnvFlag
 	MapSize    uint64
 	MaxReaders uint
+	// MaxBuckets is the maximum number of buckets. Each nested bucket counts as a bucket of its own,
+	// and the internal metadata bucket takes one more. It defaults to 256, LMDB looks the buckets up
+	// linearly when they are first opened, so it should not be much larger than needed.
 	MaxBuckets uint
-	NoSync     bool
+	// NoSync skips syncing the data to the disk after each commit. It writes through a writable map (WRITEMAP),
+	// so the nested transactions are not supported.
+	NoSync bool
+	// ClearStaleReaders clears the reader slots left behind by dead processes when opening the database.
+	ClearStaleReaders bool
+	// DebugNoCopy makes the zero-copy reads of the read-only transactions return copies that are poisoned
+	// with 0xdb bytes when their transaction is closed, which exposes the values used after their lifetime.
+	DebugNoCopy bool
+
+	// MapGrowStep and MapGrowFactor enable growing the map when an Update fails because it is full.
+	// The map size is multiplied by MapGrowFactor, if it is greater than 1, and then increased by MapGrowStep.
+	// Growing waits for all the open transactions to be closed. Meanwhile the new write transactions wait
+	// but the read ones can still begin, so a goroutine keeping a transaction open can begin a read
+	// transaction, i.e. call View, but it must not begin a write one, i.e. call Update.
+	// As the read transactions keep beginning, a steady flow of overlapping ones delays the growth, and so
+	// all the writes, until there is a moment with no transaction open. The MapSize should leave enough room
+	// for the growth to be rare, and the read transactions should be kept short.
+	MapGrowStep   uint64
+	MapGrowFactor float64
+	// MaxMapSize caps the size the map can grow to, zero means no limit.
+	MaxMapSize uint64
+	// OnMapGrow is called each time the map has grown.
+	OnMapGrow func(oldSize, newSize uint64)
+
+	// MaxBatchSize is the maximum number of calls grouped in a single Batch transaction.
+	MaxBatchSize int
+	// MaxBatchDelay is the maximum delay before a Batch transaction is started.
+	MaxBatchDelay time.Duration
+
+	// Buckets holds the options of the existing buckets that use comparators,
+	// the comparators are applied every time one of these buckets is opened.
+	// The other buckets are opened with the options recorded in their metadata when they were created.
+	Buckets map[string]BucketOptions
+
+	// Logger receives the structured logs of the database: the transaction lifecycle at the debug level,
+	// the map resizes, the slow commits and the errors. Nothing is logged if it's nil.
+	Logger *slog.Logger
+	// SlowCommit is the duration above which a commit is logged as slow, it defaults to one second.
+	SlowCommit time.Duration
+
+	// DedicatedWriter makes all the Update functions, including the ones of Batch, run on a single internal
+	// goroutine that is locked to its OS thread for the lifetime of the database. The callers wait for
+	// their functions to be executed, in the order of their priority, see UpdateWithPriority.
+	// The write transactions started with Begin still run on the caller's goroutine.
+	DedicatedWriter bool
+
+	// ReadTxPoolSize is the number of read-only transactions kept to be reused once closed, along with their cursors.
+	// Each pooled transaction holds a reader slot. It defaults to 16, a negative size disables the pool.
+	ReadTxPoolSize int
 }
 
 var defaultOptions = &Options{
-	MapSize:    10 * 1024 * 1024, // 10 MB
-	MaxBuckets: 32,               // TODO: study caveats
+	MapSize:        10 * 1024 * 1024, // 10 MB
+	MaxBuckets:     256,
+	MaxBatchSize:   1000,
+	MaxBatchDelay:  10 * time.Millisecond,
+	SlowCommit:     defaultSlowCommit,
+	ReadTxPoolSize: 16,
 }
 
 func checkOpts(opts *Options) *Options {
@@ -41,17 +150,78 @@ func checkOpts(opts *Options) *Options {
 	if opts.MaxBuckets == 0 {
 		opts.MaxBuckets = defaultOptions.MaxBuckets
 	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = defaultOptions.MaxBatchSize
+	}
+	if opts.MaxBatchDelay <= 0 {
+		opts.MaxBatchDelay = defaultOptions.MaxBatchDelay
+	}
+	if opts.SlowCommit <= 0 {
+		opts.SlowCommit = defaultOptions.SlowCommit
+	}
+	if opts.ReadTxPoolSize == 0 {
+		opts.ReadTxPoolSize = defaultOptions.ReadTxPoolSize
+	}
+	if opts.ReadOnly {
+		opts.Flags |= RDONLY
+	} else if opts.Flags&RDONLY != 0 {
+		opts.ReadOnly = true
+	}
 	if opts.NoSync {
 		opts.Flags |= mdb.NOSYNC | mdb.NOMETASYNC | mdb.WRITEMAP | mdb.MAPASYNC
 	}
 	return opts
 }
 
+// validate checks the environment flags, including the ones set by the other options.
+func (opts *Options) validate() error {
+	if opts.Flags&^envFlags != 0 {
+		return ErrInvalidEnvFlags
+	} else if opts.Flags&MAPASYNC != 0 && opts.Flags&WRITEMAP == 0 {
+		return fmt.Errorf("%w: MAPASYNC requires WRITEMAP", ErrInvalidEnvFlags)
+	} else if opts.Flags&RDONLY != 0 && opts.Flags&rdonlyFlags != 0 {
+		return fmt.Errorf("%w: write options in read-only mode", ErrInvalidEnvFlags)
+	}
+	return nil
+}
+
+// nestedTxSupported returns whether the environment supports nested transactions, LMDB rejects them with WRITEMAP.
+func (db *DB) nestedTxSupported() bool {
+	return db.opts.Flags&WRITEMAP == 0
+}
+
+func (opts *Options) growable() bool {
+	return opts.MapGrowStep > 0 || opts.MapGrowFactor > 1
+}
+
+// nextMapSize returns the size the map should grow to from the given size.
+func (opts *Options) nextMapSize(size uint64) uint64 {
+	next := size
+	if opts.MapGrowFactor > 1 {
+		next = uint64(float64(size) * opts.MapGrowFactor)
+	}
+	next += opts.MapGrowStep
+	if opts.MaxMapSize > 0 && next > opts.MaxMapSize {
+		next = opts.MaxMapSize
+	}
+	return next
+}
+
 // Open creates and opens a database at the given path.
 // If the directory does not exist then it will be created automatically.
 // Passing in nil options will cause BMDB to open the database with the default options.
 func Open(path string, mode os.FileMode, opts *Options) (*DB, error) {
 	opts = checkOpts(opts)
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	bucketOpts := make(map[string]BucketOptions, len(opts.Buckets))
+	for name, bopts := range opts.Buckets {
+		if err := bopts.validate(); err != nil {
+			return nil, err
+		}
+		bucketOpts[name] = bopts
+	}
 	env, err := mdb.NewEnv()
 	if err != nil {
 		return nil, err
@@ -71,19 +241,36 @@ func Open(path string, mode os.FileMode, opts *Options) (*DB, error) {
 		return nil, err
 	}
 
-	if err := os.MkdirAll(path, 0755); err != nil {
-		env.Close()
-		return nil, err
+	if !opts.ReadOnly {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			env.Close()
+			return nil, err
+		}
 	}
 	if err = env.Open(path, uint(opts.Flags), uint(mode)); err != nil {
 		env.Close()
 		return nil, err
 	}
+	if opts.ClearStaleReaders {
+		if _, err = env.ReaderCheck(); err != nil {
+			env.Close()
+			return nil, err
+		}
+	}
 	db := &DB{
 		path:         path,
 		env:          env,
 		opts:         opts,
+		logger:       newLogger(opts, path),
 		transactions: make(map[*Tx]struct{}, registryMapCap),
+		dbis:         make(map[string]mdb.DBI),
+		bucketOpts:   bucketOpts,
+		recordedOpts: make(map[string]BucketOptions),
+	}
+	db.mapCond = sync.NewCond(&db.mapMux)
+	if opts.DedicatedWriter && !opts.ReadOnly {
+		db.writer = newWriter()
+		go db.runWriter(db.writer)
 	}
 	registerDB(db)
 	return db, nil
@@ -95,6 +282,8 @@ func (db *DB) Path() string {
 }
 
 // Close releases all database resources. All transactions will be aborted.
+// With the dedicated writer, Close waits for the Update function in progress to end,
+// while the queued ones fail with ErrDatabaseNotOpen.
 func (db *DB) Close() error {
 	defer unregisterDB(db)
 	return db.close()
@@ -104,6 +293,11 @@ func (db *DB) close() error {
 	if db.closed {
 		return ErrDatabaseNotOpen
 	}
+	if db.writer != nil {
+		// the write transaction in flight must be ended by the writer's own thread, that holds its lock
+		db.writer.stop()
+		<-db.writer.exited
+	}
 	db.closed = true
 	db.mux.Lock()
 	defer db.mux.Unlock()
@@ -111,6 +305,13 @@ func (db *DB) close() error {
 		tx.close()
 	}
 	db.transactions = nil
+	db.drainReadTxs()
+	db.dbiMux.Lock()
+	for _, dbi := range db.dbis {
+		db.env.DBIClose(dbi)
+	}
+	db.dbis = nil
+	db.dbiMux.Unlock()
 	return db.env.Close()
 }
 
@@ -120,74 +321,264 @@ func (db *DB) close() error {
 func (db *DB) Begin(writable bool) (*Tx, error) {
 	if db.closed {
 		return nil, ErrDatabaseNotOpen
+	} else if writable && db.opts.ReadOnly {
+		return nil, ErrDatabaseReadOnly
 	}
 	var flags uint
 	if !writable {
 		flags = mdb.RDONLY
 	}
-	txn, err := db.env.BeginTxn(nil, flags)
+	db.acquireMap(writable)
+	var (
+		txn    *mdb.Txn
+		err    error
+		pooled *readTxn
+	)
+	if !writable {
+		pooled = db.renewReadTx()
+	}
+	if pooled != nil {
+		txn = pooled.txn
+	} else {
+		txn, err = db.env.BeginTxn(nil, flags)
+	}
+	for err == mdb.MapResized {
+		// another process grew the map, adopt its size and try again
+		db.releaseMap()
+		adoptErr := db.adoptMapSize()
+		db.acquireMap(writable)
+		if adoptErr != nil {
+			err = adoptErr
+			break
+		}
+		txn, err = db.env.BeginTxn(nil, flags)
+	}
 	if err != nil {
+		db.releaseMap()
+		err = wrapError("begin", nil, err)
+		db.logger.Error("failed to begin transaction", slog.Bool("writable", writable), slog.Any("error", err))
 		return nil, err
 	}
 	tx := &Tx{
+		db:       db,
 		txn:      txn,
+		id:       db.txSeq.Add(1),
+		ctx:      context.Background(),
 		writable: writable,
-		cursors:  make(map[*Cursor]struct{}, registryMapCap),
+		started:  time.Now(),
+	}
+	if pooled != nil {
+		tx.pooled, tx.idleCursors, tx.cursors = pooled, pooled.idleCursors, pooled.cursors
+	} else {
+		tx.cursors = make(map[*Cursor]struct{}, registryMapCap)
 	}
 	db.registerTransaction(tx)
+	tx.log(slog.LevelDebug, "transaction started")
 	tx.closeCallback = func() {
+		db.releaseMap()
 		if db.closed {
 			return
 		}
 		db.unregisterTransaction(tx)
 	}
+	db.txBegan(tx)
 	return tx, nil
 }
 
+// OnTxBegin adds an observer function to be executed each time a transaction begins,
+// including the nested and the managed transactions.
+func (db *DB) OnTxBegin(fn func(tx *Tx)) {
+	db.hooksMux.Lock()
+	db.beginHooks = append(db.beginHooks, fn)
+	db.hooksMux.Unlock()
+}
+
+// OnTxEnd adds an observer function to be executed each time a transaction ends,
+// including the nested and the managed transactions. Committed reports whether the transaction
+// was committed, or else rolled back or aborted. The transaction must not be used by the observer.
+func (db *DB) OnTxEnd(fn func(tx *Tx, committed bool)) {
+	db.hooksMux.Lock()
+	db.endHooks = append(db.endHooks, fn)
+	db.hooksMux.Unlock()
+}
+
+func (db *DB) txBegan(tx *Tx) {
+	db.hooksMux.RLock()
+	hooks := db.beginHooks
+	db.hooksMux.RUnlock()
+	for _, fn := range hooks {
+		fn(tx)
+	}
+}
+
+func (db *DB) txEnded(tx *Tx, committed bool) {
+	db.hooksMux.RLock()
+	hooks := db.endHooks
+	db.hooksMux.RUnlock()
+	for _, fn := range hooks {
+		fn(tx, committed)
+	}
+}
+
 // Update executes a function within the context of a read-write managed transaction.
 // If no error is returned from the function then the transaction is committed.
 // If an error is returned then the entire transaction is rolled back.
 // Any error that is returned from the function or returned from the commit is returned from the Update() method.
+//
+// If the map growth is enabled in the options and the function or the commit fails with mdb.MapFull,
+// the map is grown and the function is executed again in a new transaction.
 func (db *DB) Update(fn func(*Tx) error) error {
+	return db.UpdateContext(context.Background(), fn)
+}
+
+// UpdateContext is like Update, but the transaction is bound to the context.
+// The transaction is not started if the context is already done. Once the context is done
+// the operations of the transaction, its buckets and its cursors fail, and the transaction
+// is rolled back with the context's error returned.
+func (db *DB) UpdateContext(ctx context.Context, fn func(*Tx) error) error {
+	return db.UpdateWithPriority(ctx, PriorityNormal, fn)
+}
+
+// UpdateWithPriority is like UpdateContext, but with the dedicated writer enabled the function is executed
+// before the waiting functions of a lower priority. The priority has no effect without the dedicated writer.
+func (db *DB) UpdateWithPriority(ctx context.Context, priority WritePriority, fn func(*Tx) error) error {
+	if db.opts.ReadOnly {
+		return ErrDatabaseReadOnly
+	} else if db.writer != nil {
+		return db.writer.submit(ctx, priority, fn)
+	}
+	return db.updateGrow(ctx, fn)
+}
+
+// updateGrow executes the function in a write transaction, growing the map as needed.
+func (db *DB) updateGrow(ctx context.Context, fn func(*Tx) error) error {
+	for {
+		err := db.update(ctx, fn)
+		if err == nil || !db.opts.growable() || !errors.Is(err, mdb.MapFull) {
+			return err
+		}
+		if growErr := db.growMap(); growErr != nil {
+			db.logger.Error("failed to resize the map", slog.Any("error", growErr))
+			return err
+		}
+	}
+}
+
+func (db *DB) update(ctx context.Context, fn func(*Tx) error) error {
 	if db.closed {
 		return ErrDatabaseNotOpen
-	}
-	tx, err := db.Begin(true)
-	if err != nil {
+	} else if err := ctx.Err(); err != nil {
 		return err
 	}
-	// db.registerTransaction(tx)
-	// defer db.unregisterTransaction(tx)
-	tx.managed = true
-	err = fn(tx)
-	tx.managed = false
+	tx, err := db.Begin(true)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	return tx.Commit()
+	return tx.run(ctx, fn)
 }
 
 // View executes a function within the context of a managed read-only transaction.
 // Any error that is returned from the function is returned from the View() method.
 func (db *DB) View(fn func(*Tx) error) error {
+	return db.ViewContext(context.Background(), fn)
+}
+
+// ViewContext is like View, but the transaction is bound to the context.
+// Once the context is done the operations of the transaction, its buckets and its cursors fail,
+// and the context's error is returned.
+func (db *DB) ViewContext(ctx context.Context, fn func(*Tx) error) error {
 	if db.closed {
 		return ErrDatabaseNotOpen
+	} else if err := ctx.Err(); err != nil {
+		return err
 	}
 	tx, err := db.Begin(false)
 	if err != nil {
 		return err
 	}
-	// db.registerTransaction(tx)
-	// defer db.unregisterTransaction(tx)
-	tx.managed = true
-	err = fn(tx)
-	tx.managed = false
+	return tx.run(ctx, fn)
+}
+
+// acquireMap registers a new top-level transaction, a write transaction waits for a pending resize first.
+// The read transactions don't wait, since their goroutine may keep open a transaction the resize waits for.
+func (db *DB) acquireMap(writable bool) {
+	db.mapMux.Lock()
+	for writable && db.resizing {
+		db.mapCond.Wait()
+	}
+	db.openTxs++
+	db.mapMux.Unlock()
+}
+
+// releaseMap unregisters a closed top-level transaction.
+func (db *DB) releaseMap() {
+	db.mapMux.Lock()
+	db.openTxs--
+	if db.openTxs == 0 {
+		db.mapCond.Broadcast()
+	}
+	db.mapMux.Unlock()
+}
+
+// resizeMap calls fn to resize the map once all the open transactions are closed.
+// It's delayed for as long as the read transactions overlap, see Options.MapGrowStep.
+func (db *DB) resizeMap(fn func() error) error {
+	db.mapMux.Lock()
+	defer db.mapMux.Unlock()
+	for db.resizing {
+		db.mapCond.Wait()
+	}
+	db.resizing = true
+	for db.openTxs > 0 {
+		db.mapCond.Wait()
+	}
+	err := fn()
+	db.resizing = false
+	db.mapCond.Broadcast()
+	return err
+}
+
+// growMap increases the map size according to the options,
+// it waits until all the open transactions are closed.
+func (db *DB) growMap() error {
+	return db.resizeMap(db.grow)
+}
+
+func (db *DB) grow() error {
+	if db.closed {
+		return ErrDatabaseNotOpen
+	}
+	info, err := db.env.Info()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	return tx.Commit()
+	size := db.opts.nextMapSize(info.MapSize)
+	if size <= info.MapSize {
+		return mdb.MapFull
+	}
+	if err = db.env.SetMapSize(size); err != nil {
+		return err
+	}
+	db.logger.Info("map resized", slog.Uint64("old_size", info.MapSize), slog.Uint64("new_size", size))
+	if db.opts.OnMapGrow != nil {
+		db.opts.OnMapGrow(info.MapSize, size)
+	}
+	return nil
+}
+
+// adoptMapSize sets the map size to the size grown by another process,
+// it waits until all the open transactions are closed.
+func (db *DB) adoptMapSize() error {
+	return db.resizeMap(func() error {
+		if db.closed {
+			return ErrDatabaseNotOpen
+		}
+		if err := db.env.SetMapSize(0); err != nil {
+			return err
+		}
+		db.logger.Info("map size adopted from another process")
+		return nil
+	})
 }
 
 func (db *DB) registerTransaction(tx *Tx) {
@@ -208,9 +599,65 @@ func (db *DB) unregisterTransaction(tx *Tx) {
 	db.mux.Unlock()
 }
 
+// bucketOptions returns the options of a bucket with comparators,
+// the ones of Options.Buckets or else the ones recorded in its metadata.
+func (db *DB) bucketOptions(name string) (BucketOptions, bool) {
+	db.mux.RLock()
+	opts, ok := db.bucketOpts[name]
+	if !ok {
+		opts, ok = db.recordedOpts[name]
+	}
+	db.mux.RUnlock()
+	return opts, ok
+}
+
+// recordBucketOptions keeps the options recorded in the metadata of a committed bucket.
+func (db *DB) recordBucketOptions(name string, opts BucketOptions) {
+	db.mux.Lock()
+	if opts.hasComparators() {
+		db.recordedOpts[name] = opts
+	} else {
+		delete(db.recordedOpts, name)
+	}
+	db.mux.Unlock()
+}
+
+// forgetBucketOptions removes the recorded options of a dropped bucket.
+func (db *DB) forgetBucketOptions(name string) {
+	db.mux.Lock()
+	delete(db.recordedOpts, name)
+	db.mux.Unlock()
+}
+
 func (db *DB) activeTransactionsCount() int {
 	db.mux.RLock()
 	n := len(db.transactions)
 	db.mux.RUnlock()
 	return n
 }
+
+// cachedDBI returns the cached handle of a named bucket.
+func (db *DB) cachedDBI(name string) (mdb.DBI, bool) {
+	db.dbiMux.RLock()
+	dbi, ok := db.dbis[name]
+	db.dbiMux.RUnlock()
+	return dbi, ok
+}
+
+// cacheDBIs adds the handles opened by a committed transaction to the cache.
+func (db *DB) cacheDBIs(dbis map[string]mdb.DBI) {
+	db.dbiMux.Lock()
+	if db.dbis != nil {
+		for name, dbi := range dbis {
+			db.dbis[name] = dbi
+		}
+	}
+	db.dbiMux.Unlock()
+}
+
+// uncacheDBI removes the handle of a dropped bucket from the cache.
+func (db *DB) uncacheDBI(name string) {
+	db.dbiMux.Lock()
+	delete(db.dbis, name)
+	db.dbiMux.Unlock()
+}
@@ -1,9 +1,20 @@
 package bmdb
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/missionMeteora/bmdb/mdb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -84,3 +95,598 @@ func TestBeginRollbackCommit(t *testing.T) {
 		}
 	})
 }
+
+func TestMapGrowth(t *testing.T) {
+	assert := assert.New(t)
+	var grows [][2]uint64
+	db, err := getDBWithOptions(&Options{
+		MapSize:       64 * 1024,
+		MapGrowStep:   64 * 1024,
+		MapGrowFactor: 2,
+		MaxMapSize:    4 * 1024 * 1024,
+		OnMapGrow: func(oldSize, newSize uint64) {
+			grows = append(grows, [2]uint64{oldSize, newSize})
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	val := make([]byte, 1024)
+	put := func(n int) error {
+		return db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucketIfNotExists(FOO)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				if err := b.Put([]byte(fmt.Sprintf("%06d", i)), val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if !assert.NoError(put(512)) {
+		return
+	}
+	if assert.NotEmpty(grows) {
+		assert.Equal([2]uint64{64 * 1024, 192 * 1024}, grows[0])
+	}
+	assert.NoError(db.View(func(tx *Tx) error {
+		stats, err := tx.Bucket(FOO).Stats()
+		if err != nil {
+			return err
+		}
+		assert.Equal(uint64(512), stats.Entries)
+		return nil
+	}))
+	assert.True(errors.Is(put(8192), mdb.MapFull))
+}
+
+func TestMapGrowthOpenTx(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{
+		MapSize:     64 * 1024,
+		MapGrowStep: 1024 * 1024,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	rtx, err := db.Begin(false)
+	if !assert.NoError(err) {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Update(func(tx *Tx) error {
+			val := make([]byte, 1024)
+			for i := 0; i < 256; i++ {
+				if err := tx.Put([]byte(fmt.Sprintf("%06d", i)), val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}()
+	for resizing := false; !resizing; time.Sleep(time.Millisecond) {
+		db.mapMux.Lock()
+		resizing = db.resizing
+		db.mapMux.Unlock()
+	}
+	// the resize waits for rtx, which doesn't keep its goroutine from beginning more read transactions
+	assert.NoError(db.View(func(tx *Tx) error {
+		assert.Nil(tx.Get([]byte("000000")))
+		return nil
+	}))
+	assert.NoError(rtx.Rollback())
+	assert.NoError(<-done)
+}
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	db, err := getDBWithOptions(&Options{
+		Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.Update(func(tx *Tx) error {
+		_, err := tx.CreateBucket(FOO)
+		return err
+	}))
+	assert.Error(db.View(func(tx *Tx) error {
+		return ErrBucketNotFound
+	}))
+	out := buf.String()
+	assert.Contains(out, "path="+db.Path())
+	assert.Contains(out, `msg="transaction started"`)
+	assert.Contains(out, `msg="transaction committed"`)
+	assert.Contains(out, `msg="transaction rolled back"`)
+	assert.Contains(out, "txn=1 writable=true")
+	assert.Contains(out, "txn=2 writable=false")
+}
+
+func TestUpdateViewContext(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		var visited int
+		assert.Equal(context.Canceled, db.ViewContext(ctx, func(tx *Tx) error {
+			return tx.Bucket(FOO).ForEach(func(k, v []byte) error {
+				visited++
+				cancel()
+				return nil
+			})
+		}))
+		assert.Equal(1, visited)
+
+		called := false
+		assert.Equal(context.Canceled, db.UpdateContext(ctx, func(tx *Tx) error {
+			called = true
+			return nil
+		}))
+		assert.False(called)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		assert.Equal(context.Canceled, db.UpdateContext(ctx, func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			if err := b.Put(FOO, BAR); err != nil {
+				return err
+			}
+			cancel()
+			assert.Equal(context.Canceled, b.Put(BAR, BAR))
+			assert.Nil(b.Get(FOO))
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Nil(tx.Bucket(FOO).Get(FOO))
+			return nil
+		}))
+	})
+}
+
+func TestReaders(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{ClearStaleReaders: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	readers, err := db.Readers()
+	assert.NoError(err)
+	assert.Empty(readers)
+	tx, err := db.Begin(false)
+	if !assert.NoError(err) {
+		return
+	}
+	readers, err = db.Readers()
+	assert.NoError(err)
+	if assert.Len(readers, 1) {
+		assert.Equal(os.Getpid(), readers[0].PID)
+	}
+	assert.NoError(tx.Rollback())
+	n, err := db.ClearStaleReaders()
+	assert.NoError(err)
+	assert.Equal(0, n)
+}
+
+func TestDBICache(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		tx, err := db.Begin(true)
+		if !assert.NoError(err) {
+			return
+		}
+		_, err = tx.CreateBucket(FOO)
+		assert.NoError(err)
+		assert.NoError(tx.Rollback())
+		_, ok := db.cachedDBI("foo")
+		assert.False(ok)
+
+		// a reader started before the bucket is created doesn't see it through the cache
+		rtx, err := db.Begin(false)
+		if !assert.NoError(err) {
+			return
+		}
+		defer rtx.Rollback()
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucket(FOO)
+			if err != nil {
+				return err
+			}
+			return b.Put(FOO, BAR)
+		}))
+		dbi, ok := db.cachedDBI("foo")
+		assert.True(ok)
+		assert.Nil(rtx.Bucket(FOO))
+
+		assert.NoError(db.View(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			if assert.NotNil(b) {
+				assert.Equal(dbi, b.dbi)
+				assert.Equal(BAR, b.Get(FOO))
+			}
+			return nil
+		}))
+		assert.NoError(db.Update(func(tx *Tx) error {
+			return tx.DeleteBucket(FOO)
+		}))
+		_, ok = db.cachedDBI("foo")
+		assert.False(ok)
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Nil(tx.Bucket(FOO))
+			return nil
+		}))
+	})
+}
+
+func TestReadTxPool(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{ReadTxPoolSize: 2})
+	if !assert.NoError(err) {
+		return
+	}
+	if !assert.NoError(fillBucket(db, FOO)) {
+		return
+	}
+	view := func(tx *Tx) error {
+		c, err := tx.Bucket(FOO).Cursor()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		k, _ := c.First()
+		assert.Equal(testKeys[0], k)
+		return nil
+	}
+	var first *Tx
+	var firstBucket *Bucket
+	assert.NoError(db.View(func(tx *Tx) error {
+		first, firstBucket = tx, tx.Bucket(FOO)
+		return view(tx)
+	}))
+	tx, err := db.Begin(false)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Len(tx.idleCursors[cursorSlot{dbi: tx.Bucket(FOO).dbi}], 1)
+	// the handles of the closed transaction don't come back to life with its LMDB transaction
+	assert.Nil(firstBucket.Get(testKeys[0]))
+	assert.Equal(ErrTxDone, first.Rollback())
+	assert.NoError(view(tx))
+	assert.NoError(tx.Commit())
+	allocs := testing.AllocsPerRun(100, func() {
+		db.View(func(*Tx) error { return nil })
+	})
+	assert.LessOrEqual(allocs, 2.0)
+
+	// the pool is capped and the transactions see the updates made after they were pooled
+	txs := make([]*Tx, 3)
+	for i := range txs {
+		txs[i], err = db.Begin(false)
+		if !assert.NoError(err) {
+			return
+		}
+	}
+	assert.NoError(db.Update(func(tx *Tx) error {
+		return tx.Bucket(FOO).Put(FOO, BAR)
+	}))
+	for _, tx := range txs {
+		assert.NoError(tx.Rollback())
+	}
+	assert.Len(db.readTxs, 2)
+	assert.NoError(db.View(func(tx *Tx) error {
+		assert.Equal(BAR, tx.Bucket(FOO).Get(FOO))
+		return nil
+	}))
+
+	assert.NoError(db.Close())
+	assert.Empty(db.readTxs)
+}
+
+func TestDedicatedWriter(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{DedicatedWriter: true})
+	if !assert.NoError(err) {
+		return
+	}
+	queued := func() (n int) {
+		db.writer.mux.Lock()
+		for _, q := range db.writer.queues {
+			n += len(q)
+		}
+		db.writer.mux.Unlock()
+		return
+	}
+
+	// block the writer until the other functions are queued
+	started, release := make(chan struct{}), make(chan struct{})
+	results := make(chan string, 3)
+	go db.Update(func(tx *Tx) error {
+		close(started)
+		<-release
+		results <- "first"
+		return nil
+	})
+	<-started
+	submit := func(name string, p WritePriority) {
+		go db.UpdateWithPriority(context.Background(), p, func(tx *Tx) error {
+			results <- name
+			return tx.Put([]byte(name), BAR)
+		})
+	}
+	submit("low", PriorityLow)
+	for queued() < 1 {
+	}
+	submit("high", PriorityHigh)
+	for queued() < 2 {
+	}
+	close(release)
+	assert.Equal("first", <-results)
+	assert.Equal("high", <-results)
+	assert.Equal("low", <-results)
+
+	assert.PanicsWithValue("boom", func() {
+		db.Update(func(tx *Tx) error {
+			panic("boom")
+		})
+	})
+	assert.NoError(db.Update(func(tx *Tx) error {
+		assert.Equal(BAR, tx.Get([]byte("high")))
+		return nil
+	}))
+	assert.NoError(db.Close())
+	assert.Equal(ErrDatabaseNotOpen, db.Update(func(*Tx) error { return nil }))
+}
+
+func TestDedicatedWriterCloseQueued(t *testing.T) {
+	assert := assert.New(t)
+	for i := 0; i < 20; i++ {
+		db, err := getDBWithOptions(&Options{DedicatedWriter: true})
+		if !assert.NoError(err) {
+			return
+		}
+		const n = 20
+		errs := make(chan error, n)
+		for j := 0; j < n; j++ {
+			go func() {
+				errs <- db.Update(func(tx *Tx) error { return tx.Put(FOO, BAR) })
+			}()
+		}
+		assert.NoError(db.Close())
+		// every queued function gets a result, even if it was queued while closing
+		for j := 0; j < n; j++ {
+			select {
+			case err := <-errs:
+				if err != nil {
+					assert.Equal(ErrDatabaseNotOpen, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("an Update function queued while closing never got a result")
+			}
+		}
+	}
+}
+
+func TestDedicatedWriterCancel(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{DedicatedWriter: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- db.UpdateContext(ctx, func(tx *Tx) error {
+			close(started)
+			<-release
+			return tx.Put(FOO, BAR)
+		})
+	}()
+	<-started
+	cancel()
+	// the caller waits for the outcome of the function once it has started
+	select {
+	case err := <-done:
+		t.Fatalf("UpdateContext returned before the function ended: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(context.Canceled, <-done)
+	assert.NoError(db.View(func(tx *Tx) error {
+		assert.Nil(tx.Get(FOO))
+		return nil
+	}))
+}
+
+func TestDedicatedWriterClose(t *testing.T) {
+	testWriterClose(t, (*DB).Close)
+	// Finalize closes the databases the same way
+	testWriterClose(t, func(db *DB) error {
+		defer unregisterDB(db)
+		return db.close()
+	})
+}
+
+func testWriterClose(t *testing.T, closeDB func(*DB) error) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{DedicatedWriter: true})
+	if !assert.NoError(err) {
+		return
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Update(func(tx *Tx) error {
+			close(started)
+			<-release
+			return tx.Put(FOO, BAR)
+		})
+	}()
+	<-started
+	closed := make(chan error, 1)
+	go func() { closed <- closeDB(db) }()
+	// the write in flight is not aborted by closing, which waits for it
+	select {
+	case err := <-closed:
+		t.Fatalf("the database was closed before the write ended: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(<-done)
+	assert.NoError(<-closed)
+	select {
+	case <-db.writer.exited:
+	default:
+		t.Error("the writer is still running")
+	}
+
+	db, err = Open(db.Path(), 0644, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.View(func(tx *Tx) error {
+		assert.Equal(BAR, tx.Get(FOO))
+		return nil
+	}))
+}
+
+// readOnlyPathEnv passes the path of the database to TestReadOnlyProcess, run by TestReadOnly in a subprocess.
+// LMDB doesn't support opening the same environment twice in a process.
+const readOnlyPathEnv = "BMDB_TEST_READONLY_PATH"
+
+func TestReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Open(filepath.Join(TEST_DIR, "missing", "ro.db"), 0644, &Options{ReadOnly: true})
+	assert.Error(err)
+	_, err = os.Stat(filepath.Join(TEST_DIR, "missing"))
+	assert.True(os.IsNotExist(err))
+
+	db, err := getDBWithOptions(&Options{MapSize: 64 * 1024, MapGrowStep: 1024 * 1024})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	if !assert.NoError(fillBucket(db, FOO)) {
+		return
+	}
+
+	// the read-only database is opened by the test binary run again in another process
+	cmd := exec.Command(os.Args[0], "-test.run=^TestReadOnlyProcess$")
+	cmd.Env = append(os.Environ(), readOnlyPathEnv+"="+db.Path())
+	stdin, err := cmd.StdinPipe()
+	if !assert.NoError(err) {
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if !assert.NoError(err) {
+		return
+	}
+	if !assert.NoError(cmd.Start()) {
+		return
+	}
+	out := bufio.NewReader(stdout)
+	line, err := out.ReadString('\n')
+	if !assert.NoError(err) || !assert.Equal("ready\n", line) {
+		cmd.Wait()
+		return
+	}
+
+	// the commits of the writer are visible to the new read transactions,
+	// even once the writer has grown the map
+	val := make([]byte, 1024)
+	assert.NoError(db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket(BAR)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 256; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("%06d", i)), val); err != nil {
+				return err
+			}
+		}
+		return b.Put(FOO, BAR)
+	}))
+	stdin.Close()
+	rest, _ := io.ReadAll(out)
+	assert.NoError(cmd.Wait(), "read-only process failed:\n%s", rest)
+}
+
+// TestReadOnlyProcess is the read-only side of TestReadOnly, it only runs in the subprocess.
+func TestReadOnlyProcess(t *testing.T) {
+	path := os.Getenv(readOnlyPathEnv)
+	if path == "" {
+		t.Skip("only run by TestReadOnly")
+	}
+	assert := assert.New(t)
+	var logs bytes.Buffer
+	ro, err := Open(path, 0644, &Options{
+		ReadOnly:        true,
+		MapSize:         64 * 1024,
+		DedicatedWriter: true,
+		Logger:          slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer ro.Close()
+
+	_, err = ro.Begin(true)
+	assert.Equal(ErrDatabaseReadOnly, err)
+	assert.Equal(ErrDatabaseReadOnly, ro.Update(func(*Tx) error { return nil }))
+	assert.Equal(ErrDatabaseReadOnly, ro.Batch(func(*Tx) error { return nil }))
+	assert.NoError(ro.View(func(tx *Tx) error {
+		assert.Equal(testKeys[0], tx.Bucket(FOO).Get(testKeys[0]))
+		_, err := tx.CreateBucket(BAR)
+		assert.Equal(ErrDatabaseReadOnly, err)
+		_, err = tx.CreateBucketIfNotExists(BAR)
+		assert.Equal(ErrDatabaseReadOnly, err)
+		return nil
+	}))
+
+	// wait for the parent process to write, it closes stdin once done
+	fmt.Println("ready")
+	io.Copy(io.Discard, os.Stdin)
+	assert.NoError(ro.View(func(tx *Tx) error {
+		if b := tx.Bucket(BAR); assert.NotNil(b) {
+			assert.Equal(BAR, b.Get(FOO))
+			assert.Equal(make([]byte, 1024), b.Get([]byte("000255")))
+		}
+		return nil
+	}))
+	assert.Contains(logs.String(), "map size adopted")
+}
+
+func TestOpenFlags(t *testing.T) {
+	assert := assert.New(t)
+	for _, opts := range []*Options{
+		{Flags: EnvFlag(DUPSORT)},
+		{Flags: MAPASYNC},
+		{Flags: RDONLY | WRITEMAP},
+		{ReadOnly: true, NoSync: true},
+	} {
+		_, err := getDBWithOptions(opts)
+		assert.True(errors.Is(err, ErrInvalidEnvFlags), "%v", err)
+	}
+	db, err := getDBWithOptions(&Options{Flags: NORDAHEAD | NOMEMINIT})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(db.Close())
+	opts := &Options{Flags: RDONLY}
+	db, err = Open(db.Path(), 0644, opts)
+	if assert.NoError(err) {
+		assert.True(opts.ReadOnly)
+		assert.NoError(db.Close())
+	}
+}
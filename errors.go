@@ -0,0 +1,38 @@
+package bmdb
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/missionMeteora/bmdb/mdb"
+)
+
+// Error is returned when an operation fails in LMDB itself.
+// It records the operation and the bucket it was performed on, and unwraps to the underlying
+// mdb.Errno or syscall.Errno, so it can be inspected with errors.Is(err, mdb.MapFull) or errors.As.
+// Misuse of the API is reported with the plain sentinel errors, i.e. ErrTxNotWritable.
+type Error struct {
+	Op     string // operation that failed, i.e. "put"
+	Bucket string // name of the bucket, empty for the operations not tied to a bucket
+	Err    error  // underlying mdb.Errno or syscall.Errno
+}
+
+func (e *Error) Error() string {
+	if e.Bucket == "" {
+		return fmt.Sprintf("bmdb: %s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("bmdb: %s in bucket %q: %v", e.Op, e.Bucket, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// wrapError wraps the errors returned by the mdb package into an *Error, other errors are returned as is.
+func wrapError(op string, bucket []byte, err error) error {
+	switch err.(type) {
+	case mdb.Errno, syscall.Errno:
+		return &Error{Op: op, Bucket: string(bucket), Err: err}
+	}
+	return err
+}
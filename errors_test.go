@@ -0,0 +1,50 @@
+package bmdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/missionMeteora/bmdb/mdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucket(FOO)
+			if err != nil {
+				return err
+			}
+			if err = b.Put(FOO, BAR); err != nil {
+				return err
+			}
+
+			v, err := b.GetE(FOO)
+			assert.NoError(err)
+			assert.Equal(BAR, v)
+
+			_, err = b.GetE(BAR)
+			assert.True(errors.Is(err, mdb.NotFound))
+			var bErr *Error
+			if assert.True(errors.As(err, &bErr)) {
+				assert.Equal("get", bErr.Op)
+				assert.Equal("foo", bErr.Bucket)
+				assert.Equal(mdb.NotFound, bErr.Err)
+			}
+
+			err = b.Delete(BAR)
+			assert.True(errors.Is(err, mdb.NotFound))
+			assert.Contains(err.Error(), `delete in bucket "foo"`)
+
+			_, err = tx.BucketE(BAR)
+			assert.Equal(ErrBucketNotFound, err)
+			_, err = tx.BucketE(nil)
+			assert.Equal(ErrNoBucketName, err)
+			b, err = tx.BucketE(FOO)
+			assert.NoError(err)
+			assert.NotNil(b)
+			return nil
+		}))
+	})
+}
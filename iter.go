@@ -0,0 +1,101 @@
+package bmdb
+
+import (
+	"bytes"
+	"iter"
+)
+
+// All returns an iterator over all the key/value pairs of the bucket, in ascending order.
+// The iterator opens a cursor that is closed when the loop ends, including when it breaks.
+//
+// The iterators report no errors: they yield nothing if the cursor cannot be opened, and stop early
+// if the transaction is done or its context is done. So after the loop the callers must check
+// tx.Context().Err() to tell a complete iteration from a cancelled one, or use ForEach and Range,
+// which return the errors.
+func (b *Bucket) All() iter.Seq2[[]byte, []byte] {
+	return b.Between(nil, nil)
+}
+
+// AllReverse is like All, but the keys are visited in descending order.
+func (b *Bucket) AllReverse() iter.Seq2[[]byte, []byte] {
+	return b.BetweenReverse(nil, nil)
+}
+
+// Between returns an iterator over the key/value pairs with a key between lo and hi, inclusive,
+// in ascending order. A nil lo or hi leaves that side of the range unbounded.
+// It's the iterator counterpart of Range, which already names the callback version, hence its name.
+func (b *Bucket) Between(lo, hi []byte) iter.Seq2[[]byte, []byte] {
+	first := (*Cursor).First
+	if lo != nil {
+		first = func(c *Cursor) ([]byte, []byte) { return c.Seek(lo) }
+	}
+	return b.scan(first, (*Cursor).Next, func(k []byte) bool {
+		return hi == nil || b.compare(k, hi) <= 0
+	})
+}
+
+// BetweenReverse is like Between, but the keys are visited in descending order.
+func (b *Bucket) BetweenReverse(lo, hi []byte) iter.Seq2[[]byte, []byte] {
+	last := func(c *Cursor) ([]byte, []byte) { return b.seekLast(c, hi) }
+	return b.scan(last, (*Cursor).Prev, func(k []byte) bool {
+		return lo == nil || b.compare(k, lo) >= 0
+	})
+}
+
+// Prefix returns an iterator over the key/value pairs with a key starting with prefix, in ascending order.
+// The keys sharing a prefix are only grouped together in the buckets that sort their keys bytewise,
+// that is without a custom comparator nor the REVERSEKEY and INTEGERKEY flags.
+func (b *Bucket) Prefix(prefix []byte) iter.Seq2[[]byte, []byte] {
+	first := func(c *Cursor) ([]byte, []byte) { return c.Seek(prefix) }
+	return b.scan(first, (*Cursor).Next, func(k []byte) bool {
+		return bytes.HasPrefix(k, prefix)
+	})
+}
+
+// PrefixReverse is like Prefix, but the keys are visited in descending order.
+func (b *Bucket) PrefixReverse(prefix []byte) iter.Seq2[[]byte, []byte] {
+	last := func(c *Cursor) ([]byte, []byte) {
+		end := prefixEnd(prefix)
+		if end == nil {
+			return c.Last()
+		}
+		// end is the first key past the prefix
+		if k, _ := c.Seek(end); k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	}
+	return b.scan(last, (*Cursor).Prev, func(k []byte) bool {
+		return bytes.HasPrefix(k, prefix)
+	})
+}
+
+// scan returns an iterator that positions a new cursor with first and then moves it with next,
+// as long as the keys are accepted by in.
+func (b *Bucket) scan(first, next func(*Cursor) ([]byte, []byte), in func(k []byte) bool) iter.Seq2[[]byte, []byte] {
+	return func(yield func(k, v []byte) bool) {
+		c, err := b.Cursor()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for k, v := first(c); k != nil && in(k); k, v = next(c) {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// prefixEnd returns the smallest key greater than all the keys starting with prefix,
+// or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			end := append([]byte(nil), prefix[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
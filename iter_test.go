@@ -0,0 +1,99 @@
+package bmdb
+
+import (
+	"encoding/binary"
+	"iter"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectKeys(seq iter.Seq2[[]byte, []byte]) (keys []string) {
+	for k := range seq {
+		keys = append(keys, string(k))
+	}
+	return
+}
+
+func TestBucketIterators(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		if !assert.NoError(fillBucket(db, FOO)) {
+			return
+		}
+		assert.NoError(db.View(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			assert.Equal([]string{"a1", "a2", "b1", "b2", "c1"}, collectKeys(b.All()))
+			assert.Equal([]string{"c1", "b2", "b1", "a2", "a1"}, collectKeys(b.AllReverse()))
+			assert.Equal([]string{"a2", "b1", "b2"}, collectKeys(b.Between([]byte("a2"), []byte("b2"))))
+			assert.Equal([]string{"b2", "b1", "a2"}, collectKeys(b.BetweenReverse([]byte("a2"), []byte("b3"))))
+			assert.Equal([]string{"b1", "b2"}, collectKeys(b.Prefix([]byte("b"))))
+			assert.Equal([]string{"b2", "b1"}, collectKeys(b.PrefixReverse([]byte("b"))))
+			assert.Equal([]string{"c1"}, collectKeys(b.PrefixReverse([]byte("c"))))
+			assert.Empty(collectKeys(b.Prefix([]byte("d"))))
+
+			for k, v := range b.All() {
+				assert.Equal(k, v)
+				break
+			}
+			assert.Equal(0, tx.activeCursorsCount())
+			return nil
+		}))
+
+		// the cursors of a write transaction are tracked as well
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			for k := range b.Prefix([]byte("a")) {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			assert.Equal(0, tx.activeCursorsCount())
+			_, err := b.Cursor()
+			assert.NoError(err)
+			assert.Equal(1, tx.activeCursorsCount())
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal([]string{"b1", "b2", "c1"}, collectKeys(tx.Bucket(FOO).All()))
+			return nil
+		}))
+	})
+}
+
+func TestIntegerKeyRanges(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		key := func(n uint64) []byte {
+			return binary.NativeEndian.AppendUint64(nil, n)
+		}
+		assert.NoError(db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucketWithOptions(FOO, BucketOptions{Flags: INTEGERKEY})
+			if err != nil {
+				return err
+			}
+			for _, n := range []uint64{1, 2, 3, 256, 1000} {
+				if err := b.Put(key(n), nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		assert.NoError(db.View(func(tx *Tx) error {
+			b := tx.Bucket(FOO)
+			var keys []uint64
+			for k := range b.Between(key(2), key(256)) {
+				keys = append(keys, binary.NativeEndian.Uint64(k))
+			}
+			assert.Equal([]uint64{2, 3, 256}, keys)
+
+			keys = keys[:0]
+			assert.NoError(b.Range(key(2), key(256), true, func(k, _ []byte) error {
+				keys = append(keys, binary.NativeEndian.Uint64(k))
+				return nil
+			}))
+			assert.Equal([]uint64{256, 3, 2}, keys)
+			return nil
+		}))
+	})
+}
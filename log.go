@@ -0,0 +1,52 @@
+package bmdb
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// defaultSlowCommit is the default duration above which a commit is logged as slow.
+const defaultSlowCommit = time.Second
+
+// discardHandler drops all the records, it's used when no logger is provided in the options.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// newLogger returns the logger of a database, its records are tagged with the database path.
+func newLogger(opts *Options, path string) *slog.Logger {
+	if opts.Logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return opts.Logger.With(slog.String("path", path))
+}
+
+// log writes a record about the transaction, tagged with its ID and whether it's writable.
+func (tx *Tx) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := tx.db.logger
+	if !logger.Enabled(tx.ctx, level) {
+		return
+	}
+	attrs = append(attrs, slog.Uint64("txn", tx.id), slog.Bool("writable", tx.writable))
+	if tx.parent != nil {
+		attrs = append(attrs, slog.Uint64("parent", tx.parent.id))
+	}
+	logger.LogAttrs(tx.ctx, level, msg, attrs...)
+}
+
+// logCommit writes the record about a commit that took the given duration,
+// failed and slow commits are logged above the debug level.
+func (tx *Tx) logCommit(d time.Duration, err error) {
+	duration := slog.Duration("duration", d)
+	if err != nil {
+		tx.log(slog.LevelError, "commit failed", duration, slog.Any("error", err))
+	} else if d >= tx.db.opts.SlowCommit {
+		tx.log(slog.LevelWarn, "slow commit", duration)
+	} else {
+		tx.log(slog.LevelDebug, "transaction committed", duration)
+	}
+}
@@ -224,6 +224,43 @@ func BenchmarkCursorScanValRDONLY(b *testing.B) {
 	b.StopTimer()
 }
 
+// repeatedly open the handle of a named database, as done when it isn't cached.
+func BenchmarkTxnDBIOpenRDONLY(b *testing.B) {
+	env, path := setupBenchDB(b)
+	defer teardownBenchDB(b, env, path)
+
+	openBenchDBI(b, env)
+
+	txn, err := env.BeginTxn(nil, RDONLY)
+	bMust(b, err, "starting transaction")
+	defer txn.Abort()
+	name := "benchmark"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := txn.DBIOpen(&name, 0)
+		bMust(b, err, "opening dbi")
+	}
+	b.StopTimer()
+}
+
+// repeatedly check a cached handle of a named database, as done before reusing it.
+func BenchmarkTxnDBIFlagsRDONLY(b *testing.B) {
+	env, path := setupBenchDB(b)
+	defer teardownBenchDB(b, env, path)
+
+	dbi := openBenchDBI(b, env)
+
+	txn, err := env.BeginTxn(nil, RDONLY)
+	bMust(b, err, "starting transaction")
+	defer txn.Abort()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := txn.DBIFlags(dbi)
+		bMust(b, err, "getting dbi flags")
+	}
+	b.StopTimer()
+}
+
 func setupBenchDB(b *testing.B) (*Env, string) {
 	env, err := NewEnv()
 	bMust(b, err, "creating env")
@@ -0,0 +1,68 @@
+package mdb
+
+/*
+#include <stdint.h>
+#include "lmdb.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime/cgo"
+	"sync"
+)
+
+// The Go functions called back by LMDB. They are kept in this file because
+// a file using //export must only contain declarations in its preamble.
+
+//export lmdbgoMsgFunc
+func lmdbgoMsgFunc(msg *C.char, ctx C.uintptr_t) C.int {
+	fn := cgo.Handle(ctx).Value().(func(string) error)
+	if err := fn(C.GoString(msg)); err != nil {
+		return -1
+	}
+	return 0
+}
+
+// CmpFunc compares two keys, or two values of a DUPSORT database. It returns a negative number
+// if a sorts before b, zero if they are equal and a positive number if a sorts after b.
+type CmpFunc func(a, b []byte) int
+
+// Cmp is a comparison function registered with RegisterCmpFunc.
+type Cmp int
+
+// MaxCmpFuncs is the maximum number of comparison functions that can be registered.
+// LMDB comparison functions take no context, so each one is bound to its own C trampoline.
+const MaxCmpFuncs = 32
+
+var (
+	cmpMux   sync.RWMutex
+	cmpFuncs []CmpFunc
+)
+
+// RegisterCmpFunc registers a comparison function so that it can be used with SetCompare and SetDupSort.
+// The registered functions are kept for the lifetime of the process.
+func RegisterCmpFunc(fn CmpFunc) (Cmp, error) {
+	cmpMux.Lock()
+	defer cmpMux.Unlock()
+	if len(cmpFuncs) >= MaxCmpFuncs {
+		return 0, errors.New("too many comparison functions")
+	}
+	cmpFuncs = append(cmpFuncs, fn)
+	return Cmp(len(cmpFuncs) - 1), nil
+}
+
+func (cmp Cmp) valid() bool {
+	cmpMux.RLock()
+	n := len(cmpFuncs)
+	cmpMux.RUnlock()
+	return cmp >= 0 && int(cmp) < n
+}
+
+//export lmdbgoCompare
+func lmdbgoCompare(slot C.int, a, b *C.MDB_val) C.int {
+	cmpMux.RLock()
+	fn := cmpFuncs[slot]
+	cmpMux.RUnlock()
+	return C.int(fn((*Val)(a).BytesNoCopy(), (*Val)(b).BytesNoCopy()))
+}
@@ -66,7 +66,7 @@ func (cursor *Cursor) Txn() *Txn {
 	var _txn *C.MDB_txn
 	_txn = C.mdb_cursor_txn(cursor._cursor)
 	if _txn != nil {
-		return &Txn{_txn}
+		return &Txn{_txn: _txn}
 	}
 	return nil
 }
@@ -7,13 +7,25 @@ package mdb
 #cgo netbsd CFLAGS: -DMDB_DSYNC=O_SYNC
 #include <stdlib.h>
 #include <stdio.h>
+#include <stdint.h>
 #include "lmdb.h"
+
+extern int lmdbgoMsgFunc(char *msg, uintptr_t ctx);
+
+static int lmdbgo_msg_func(const char *msg, void *ctx) {
+    return lmdbgoMsgFunc((char *)msg, (uintptr_t)ctx);
+}
+
+static int lmdbgo_mdb_reader_list(MDB_env *env, uintptr_t ctx) {
+    return mdb_reader_list(env, lmdbgo_msg_func, (void *)ctx);
+}
 */
 import "C"
 
 import (
 	"errors"
 	"fmt"
+	"runtime/cgo"
 	"syscall"
 	"unsafe"
 )
@@ -30,6 +42,14 @@ const (
 	WRITEMAP   = C.MDB_WRITEMAP   // use writable mmap
 	MAPASYNC   = C.MDB_MAPASYNC   // use asynchronous msync when MDB_WRITEMAP is use
 	NOTLS      = C.MDB_NOTLS      // tie reader locktable slots to Txn objects instead of threads
+	NOLOCK     = C.MDB_NOLOCK     // don't do any locking, caller must manage their own locks
+	NORDAHEAD  = C.MDB_NORDAHEAD  // don't do readahead (no effect on Windows)
+	NOMEMINIT  = C.MDB_NOMEMINIT  // don't initialize malloc'd memory before writing to datafile
+)
+
+// mdb_env_copy2 Copy Flags
+const (
+	CP_COMPACT = C.MDB_CP_COMPACT // omit free space from copy, and renumber all pages sequentially
 )
 
 type DBI uint
@@ -130,6 +150,19 @@ func (env *Env) Copy(path string) error {
 	return errno(ret)
 }
 
+func (env *Env) Copy2(path string, flags uint) error {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	ret := C.mdb_env_copy2(env._env, cpath, C.uint(flags))
+	return errno(ret)
+}
+
+// CopyFD copies the environment to the file descriptor, which must be open for writing.
+func (env *Env) CopyFD(fd uintptr, flags uint) error {
+	ret := C.mdb_env_copyfd2(env._env, C.mdb_filehandle_t(fd), C.uint(flags))
+	return errno(ret)
+}
+
 // Statistics for a database in the environment
 type Stat struct {
 	PSize         uint   // Size of a database page. This is currently the same for all databases.
@@ -225,3 +258,33 @@ func (env *Env) SetMaxDBs(size DBI) error {
 func (env *Env) DBIClose(dbi DBI) {
 	C.mdb_dbi_close(env._env, C.MDB_dbi(dbi))
 }
+
+// ReaderList calls fn with each line of the reader lock table dump.
+// The first line is a header, unless the table has no active readers.
+// The listing stops at the first error returned by fn, which is returned.
+func (env *Env) ReaderList(fn func(msg string) error) error {
+	var fnErr error
+	h := cgo.NewHandle(func(msg string) error {
+		fnErr = fn(msg)
+		return fnErr
+	})
+	defer h.Delete()
+	ret := C.lmdbgo_mdb_reader_list(env._env, C.uintptr_t(h))
+	if fnErr != nil {
+		return fnErr
+	} else if ret < 0 {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// ReaderCheck clears the stale entries from the reader lock table
+// and returns the number of cleared entries.
+func (env *Env) ReaderCheck() (int, error) {
+	var _dead C.int
+	ret := C.mdb_reader_check(env._env, &_dead)
+	if ret != SUCCESS {
+		return 0, errno(ret)
+	}
+	return int(_dead), nil
+}
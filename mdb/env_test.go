@@ -77,3 +77,31 @@ func TestEnvCopy(t *testing.T) {
 	env := setup(t)
 	clean(env, t)
 }
+
+func TestEnvReaderList(t *testing.T) {
+	env := setup(t)
+	defer clean(env, t)
+	txn, err := env.BeginTxn(nil, RDONLY)
+	if err != nil {
+		t.Fatalf("Cannot begin transaction: %s", err)
+	}
+	defer txn.Abort()
+	var lines []string
+	err = env.ReaderList(func(msg string) error {
+		lines = append(lines, msg)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Cannot list readers: %s", err)
+	}
+	if len(lines) != 2 {
+		t.Errorf("Expected a header and one reader, got %q", lines)
+	}
+	dead, err := env.ReaderCheck()
+	if err != nil {
+		t.Errorf("Cannot check readers: %s", err)
+	}
+	if dead != 0 {
+		t.Errorf("Expected no stale readers, got %d", dead)
+	}
+}
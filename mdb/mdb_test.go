@@ -1,6 +1,7 @@
 package mdb
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -111,3 +112,55 @@ func TestTest1(t *testing.T) {
 	}
 	txn.Abort()
 }
+
+func TestSetCompare(t *testing.T) {
+	env := setup(t)
+	defer clean(env, t)
+	reverse, err := RegisterCmpFunc(func(a, b []byte) int {
+		return bytes.Compare(b, a)
+	})
+	if err != nil {
+		t.Fatalf("Cannot register comparison function: %s", err)
+	}
+	txn, err := env.BeginTxn(nil, 0)
+	if err != nil {
+		t.Fatalf("Cannot begin transaction: %s", err)
+	}
+	defer txn.Abort()
+	dbi, err := txn.DBIOpen(nil, 0)
+	if err != nil {
+		t.Fatalf("Cannot open DBI: %s", err)
+	}
+	if err = txn.SetCompare(dbi, reverse); err != nil {
+		t.Fatalf("Cannot set comparison function: %s", err)
+	}
+	if err = txn.SetCompare(dbi, Cmp(MaxCmpFuncs)); err == nil {
+		t.Errorf("Should not set an unregistered comparison function")
+	}
+	for _, k := range []string{"b", "a", "c"} {
+		if err = txn.Put(dbi, []byte(k), []byte(k), 0); err != nil {
+			t.Fatalf("Error during put: %s", err)
+		}
+	}
+	cursor, err := txn.CursorOpen(dbi)
+	if err != nil {
+		t.Fatalf("Cannot open cursor: %s", err)
+	}
+	defer cursor.Close()
+	var keys string
+	for {
+		k, _, err := cursor.Get(nil, nil, NEXT)
+		if err == NotFound {
+			break
+		} else if err != nil {
+			t.Fatalf("Error during iteration: %s", err)
+		}
+		keys += string(k)
+	}
+	if keys != "cba" {
+		t.Errorf("Expected reverse order, got %q", keys)
+	}
+	if txn.Cmp(dbi, []byte("a"), []byte("b")) <= 0 {
+		t.Errorf("Cmp should use the comparison function of the database")
+	}
+}
@@ -15,7 +15,7 @@ static int lmdbgo_mdb_del(MDB_txn *txn, MDB_dbi dbi, void *kdata, size_t kn, voi
     MDB_val key, val;
     LMDBGO_SET_VAL(&key, kn, kdata);
     LMDBGO_SET_VAL(&val, vn, vdata);
-    return mdb_del(txn, dbi, &key, &val);
+    return mdb_del(txn, dbi, &key, vdata ? &val : NULL);
 }
 
 static int lmdbgo_mdb_get(MDB_txn *txn, MDB_dbi dbi, void *kdata, size_t kn, MDB_val *val) {
@@ -24,6 +24,13 @@ static int lmdbgo_mdb_get(MDB_txn *txn, MDB_dbi dbi, void *kdata, size_t kn, MDB
     return mdb_get(txn, dbi, &key, val);
 }
 
+static int lmdbgo_mdb_put1(MDB_txn *txn, MDB_dbi dbi, void *kdata, size_t kn, size_t vn, unsigned int flags, MDB_val *val) {
+    MDB_val key;
+    LMDBGO_SET_VAL(&key, kn, kdata);
+    LMDBGO_SET_VAL(val, vn, NULL);
+    return mdb_put(txn, dbi, &key, val, flags);
+}
+
 static int lmdbgo_mdb_put2(MDB_txn *txn, MDB_dbi dbi, void *kdata, size_t kn, void *vdata, size_t vn, unsigned int flags) {
     MDB_val key, val;
     LMDBGO_SET_VAL(&key, kn, kdata);
@@ -31,13 +38,102 @@ static int lmdbgo_mdb_put2(MDB_txn *txn, MDB_dbi dbi, void *kdata, size_t kn, vo
     return mdb_put(txn, dbi, &key, &val, flags);
 }
 
+static int lmdbgo_mdb_cmp(MDB_txn *txn, MDB_dbi dbi, void *adata, size_t an, void *bdata, size_t bn) {
+    MDB_val a, b;
+    LMDBGO_SET_VAL(&a, an, adata);
+    LMDBGO_SET_VAL(&b, bn, bdata);
+    return mdb_cmp(txn, dbi, &a, &b);
+}
+
+extern int lmdbgoCompare(int slot, MDB_val *a, MDB_val *b);
 
+// MDB_cmp_func takes no context, so every registered Go comparison function gets its own trampoline.
+#define LMDBGO_CMP(i) static int lmdbgo_cmp_##i(const MDB_val *a, const MDB_val *b) { \
+    return lmdbgoCompare(i, (MDB_val *)a, (MDB_val *)b); \
+}
+
+LMDBGO_CMP(0)
+LMDBGO_CMP(1)
+LMDBGO_CMP(2)
+LMDBGO_CMP(3)
+LMDBGO_CMP(4)
+LMDBGO_CMP(5)
+LMDBGO_CMP(6)
+LMDBGO_CMP(7)
+LMDBGO_CMP(8)
+LMDBGO_CMP(9)
+LMDBGO_CMP(10)
+LMDBGO_CMP(11)
+LMDBGO_CMP(12)
+LMDBGO_CMP(13)
+LMDBGO_CMP(14)
+LMDBGO_CMP(15)
+LMDBGO_CMP(16)
+LMDBGO_CMP(17)
+LMDBGO_CMP(18)
+LMDBGO_CMP(19)
+LMDBGO_CMP(20)
+LMDBGO_CMP(21)
+LMDBGO_CMP(22)
+LMDBGO_CMP(23)
+LMDBGO_CMP(24)
+LMDBGO_CMP(25)
+LMDBGO_CMP(26)
+LMDBGO_CMP(27)
+LMDBGO_CMP(28)
+LMDBGO_CMP(29)
+LMDBGO_CMP(30)
+LMDBGO_CMP(31)
+
+static MDB_cmp_func *lmdbgo_cmp_funcs[] = {
+    lmdbgo_cmp_0,
+    lmdbgo_cmp_1,
+    lmdbgo_cmp_2,
+    lmdbgo_cmp_3,
+    lmdbgo_cmp_4,
+    lmdbgo_cmp_5,
+    lmdbgo_cmp_6,
+    lmdbgo_cmp_7,
+    lmdbgo_cmp_8,
+    lmdbgo_cmp_9,
+    lmdbgo_cmp_10,
+    lmdbgo_cmp_11,
+    lmdbgo_cmp_12,
+    lmdbgo_cmp_13,
+    lmdbgo_cmp_14,
+    lmdbgo_cmp_15,
+    lmdbgo_cmp_16,
+    lmdbgo_cmp_17,
+    lmdbgo_cmp_18,
+    lmdbgo_cmp_19,
+    lmdbgo_cmp_20,
+    lmdbgo_cmp_21,
+    lmdbgo_cmp_22,
+    lmdbgo_cmp_23,
+    lmdbgo_cmp_24,
+    lmdbgo_cmp_25,
+    lmdbgo_cmp_26,
+    lmdbgo_cmp_27,
+    lmdbgo_cmp_28,
+    lmdbgo_cmp_29,
+    lmdbgo_cmp_30,
+    lmdbgo_cmp_31
+};
+
+static int lmdbgo_mdb_set_compare(MDB_txn *txn, MDB_dbi dbi, int slot) {
+    return mdb_set_compare(txn, dbi, lmdbgo_cmp_funcs[slot]);
+}
+
+static int lmdbgo_mdb_set_dupsort(MDB_txn *txn, MDB_dbi dbi, int slot) {
+    return mdb_set_dupsort(txn, dbi, lmdbgo_cmp_funcs[slot]);
+}
 */
 import "C"
 
 import (
 	"math"
 	"runtime"
+	"syscall"
 	"unsafe"
 )
 
@@ -66,6 +162,8 @@ const (
 // Transactions may be read-only or read-write.
 type Txn struct {
 	_txn *C.MDB_txn
+	// rdonly is set for the read-only transactions, which are not locked to their OS thread.
+	rdonly bool
 }
 
 func (env *Env) BeginTxn(parent *Txn, flags uint) (*Txn, error) {
@@ -76,30 +174,40 @@ func (env *Env) BeginTxn(parent *Txn, flags uint) (*Txn, error) {
 	} else {
 		ptxn = parent._txn
 	}
-	if flags&RDONLY == 0 {
+	rdonly := flags&RDONLY != 0
+	if !rdonly {
 		runtime.LockOSThread()
 	}
 	ret := C.mdb_txn_begin(env._env, ptxn, C.uint(flags), &_txn)
 	if ret != SUCCESS {
-		runtime.UnlockOSThread()
+		if !rdonly {
+			runtime.UnlockOSThread()
+		}
 		return nil, errno(ret)
 	}
-	return &Txn{_txn}, nil
+	return &Txn{_txn: _txn, rdonly: rdonly}, nil
 }
 
 func (txn *Txn) Commit() error {
 	ret := C.mdb_txn_commit(txn._txn)
-	runtime.UnlockOSThread()
+	txn.unlockThread()
 	txn._txn = nil
 	return errno(ret)
 }
 
 func (txn *Txn) Abort() {
 	C.mdb_txn_abort(txn._txn)
-	runtime.UnlockOSThread()
+	txn.unlockThread()
 	txn._txn = nil
 }
 
+// unlockThread releases the OS thread locked by BeginTxn for a write transaction.
+func (txn *Txn) unlockThread() {
+	if !txn.rdonly {
+		runtime.UnlockOSThread()
+	}
+}
+
 func (txn *Txn) Reset() {
 	C.mdb_txn_reset(txn._txn)
 }
@@ -125,6 +233,15 @@ func (txn *Txn) DBIOpen(name *string, flags uint) (DBI, error) {
 	return DBI(_dbi), nil
 }
 
+func (txn *Txn) DBIFlags(dbi DBI) (uint, error) {
+	var _flags C.uint
+	ret := C.mdb_dbi_flags(txn._txn, C.MDB_dbi(dbi), &_flags)
+	if ret != SUCCESS {
+		return 0, errno(ret)
+	}
+	return uint(_flags), nil
+}
+
 func (txn *Txn) Stat(dbi DBI) (*Stat, error) {
 	var _stat C.MDB_stat
 	ret := C.mdb_stat(txn._txn, C.MDB_dbi(dbi), &_stat)
@@ -176,6 +293,25 @@ func (txn *Txn) Put(dbi DBI, key []byte, val []byte, flags uint) error {
 	return errno(ret)
 }
 
+// PutReserve reserves size bytes for the value of key and returns them, so that the caller
+// can fill the value in place. The RESERVE flag is added to flags. The returned slice points
+// into the memory map and must be filled before any other operation on the transaction.
+func (txn *Txn) PutReserve(dbi DBI, key []byte, size int, flags uint) ([]byte, error) {
+	kp, kl := valBytes(key)
+	val := new(C.MDB_val)
+	ret := C.lmdbgo_mdb_put1(
+		txn._txn, C.MDB_dbi(dbi),
+		kp, kl,
+		C.size_t(size),
+		C.uint(flags|RESERVE),
+		val,
+	)
+	if ret != SUCCESS {
+		return nil, errno(ret)
+	}
+	return (*Val)(val).BytesNoCopy(), nil
+}
+
 func (txn *Txn) Del(dbi DBI, key, val []byte) error {
 	kdata, kn := valBytes(key)
 	vdata, vn := valBytes(val)
@@ -205,19 +341,33 @@ func (txn *Txn) CursorRenew(cursor *Cursor) error {
 	return errno(ret)
 }
 
-/*
-type CmpFunc func(a, b []byte) int
+// SetCompare sets the key comparison function of a database. It must be called before
+// any data access and the same function must be used every time the database is used.
+func (txn *Txn) SetCompare(dbi DBI, cmp Cmp) error {
+	if !cmp.valid() {
+		return syscall.EINVAL
+	}
+	ret := C.lmdbgo_mdb_set_compare(txn._txn, C.MDB_dbi(dbi), C.int(cmp))
+	return errno(ret)
+}
+
+// SetDupSort sets the value comparison function of a DUPSORT database. It must be called before
+// any data access and the same function must be used every time the database is used.
+func (txn *Txn) SetDupSort(dbi DBI, cmp Cmp) error {
+	if !cmp.valid() {
+		return syscall.EINVAL
+	}
+	ret := C.lmdbgo_mdb_set_dupsort(txn._txn, C.MDB_dbi(dbi), C.int(cmp))
+	return errno(ret)
+}
 
-func (txn *Txn) SetCompare(dbi DBI, cmp CmpFunc) error {
-    f := func(a, b *C.MDB_val) C.int {
-        ga := C.GoBytes(a.mv_data, C.int(a.mv_size))
-        gb := C.GoBytes(a.mv_data, C.int(a.mv_size))
-        return C.int(cmp(ga, gb))
-    }
-    ret := C.mdb_set_compare(txn._txn, C.MDB_dbi(dbi), *unsafe.Pointer(&f))
-    return errno(ret)
+// Cmp compares two keys the way a database orders them, taking its flags and its comparison function into account.
+// It returns a negative number if a sorts before b, zero if they are equal and a positive number otherwise.
+func (txn *Txn) Cmp(dbi DBI, a, b []byte) int {
+	ap, an := valBytes(a)
+	bp, bn := valBytes(b)
+	return int(C.lmdbgo_mdb_cmp(txn._txn, C.MDB_dbi(dbi), ap, an, bp, bn))
 }
-*/
-// func (txn *Txn) SetDupSort(dbi DBI, comp *C.MDB_comp_func) error
+
 // func (txn *Txn) SetRelFunc(dbi DBI, rel *C.MDB_rel_func) error
 // func (txn *Txn) SetRelCtx(dbi DBI, void *) error
@@ -11,7 +11,6 @@ package mdb
 import "C"
 
 import (
-	"reflect"
 	"unsafe"
 )
 
@@ -36,14 +35,11 @@ func (val Val) Bytes() []byte {
 	return C.GoBytes(val.mv_data, C.int(val.mv_size))
 }
 
-// If val is nil, a empty slice is retured.
+// If val is nil, a nil slice is retured.
+// The returned slice points to the memory referenced by val, it must not be
+// modified and must not be used after that memory has been released.
 func (val Val) BytesNoCopy() []byte {
-	hdr := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(val.mv_data)),
-		Len:  int(val.mv_size),
-		Cap:  int(val.mv_size),
-	}
-	return *(*[]byte)(unsafe.Pointer(&hdr))
+	return unsafe.Slice((*byte)(val.mv_data), int(val.mv_size))
 }
 
 // If val is nil, an empty string is returned.
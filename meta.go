@@ -0,0 +1,140 @@
+package bmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/missionMeteora/bmdb/mdb"
+)
+
+// metaBucketName is the name of the hidden bucket that keeps the metadata of the other buckets.
+// It is never returned by Tx.Bucket or listed by Tx.BucketNames.
+const metaBucketName = "__bmdb__"
+
+// sequencePrefix prefixes the keys of the bucket sequences within the meta bucket.
+var sequencePrefix = []byte("seq:")
+
+// bucketPrefix prefixes the keys of the bucket records within the meta bucket.
+var bucketPrefix = []byte("bucket:")
+
+// BucketInfo is the record of a bucket kept in the metadata, it's written when the bucket is created.
+type BucketInfo struct {
+	Flags         BucketFlag `json:"flags"`
+	Comparator    string     `json:"comparator,omitempty"`
+	DupComparator string     `json:"dupComparator,omitempty"`
+	Codec         string     `json:"codec,omitempty"`
+	Created       time.Time  `json:"created"`
+}
+
+// options returns the options the bucket was created with.
+func (info *BucketInfo) options() BucketOptions {
+	return BucketOptions{
+		Flags:         info.Flags,
+		Comparator:    info.Comparator,
+		DupComparator: info.DupComparator,
+		Codec:         info.Codec,
+	}
+}
+
+func isReservedName(name []byte) bool {
+	return string(name) == metaBucketName
+}
+
+// isHiddenName returns whether a database name is hidden from Tx.BucketNames,
+// it is either an internal bucket or a nested bucket.
+func isHiddenName(name []byte) bool {
+	return isReservedName(name) || bytes.IndexByte(name, bucketSeparator) >= 0
+}
+
+func metaKey(prefix, name []byte) []byte {
+	key := make([]byte, 0, len(prefix)+len(name))
+	return append(append(key, prefix...), name...)
+}
+
+// openMeta opens the meta bucket, it gets created on demand by write transactions only.
+func (tx *Tx) openMeta(create bool) (mdb.DBI, error) {
+	var flags uint
+	if create {
+		flags = mdb.CREATE
+	}
+	return tx.dbiOpen(metaBucketName, flags)
+}
+
+func (tx *Tx) sequence(name []byte) (uint64, error) {
+	dbi, err := tx.openMeta(false)
+	if err == mdb.NotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, wrapError("sequence", name, err)
+	}
+	v, err := tx.txn.Get(dbi, metaKey(sequencePrefix, name))
+	if err == mdb.NotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, wrapError("sequence", name, err)
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func (tx *Tx) setSequence(name []byte, seq uint64) error {
+	dbi, err := tx.openMeta(true)
+	if err != nil {
+		return wrapError("set sequence", name, err)
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, seq)
+	return wrapError("set sequence", name, tx.txn.Put(dbi, metaKey(sequencePrefix, name), v, 0))
+}
+
+// bucketInfo reads the record of a bucket, it returns nil if the bucket has none,
+// i.e. it was created before the records were introduced.
+func (tx *Tx) bucketInfo(name []byte) (*BucketInfo, error) {
+	dbi, err := tx.openMeta(false)
+	if err == mdb.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, wrapError("bucket info", name, err)
+	}
+	v, err := tx.txn.GetVal(dbi, metaKey(bucketPrefix, name))
+	if err == mdb.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, wrapError("bucket info", name, err)
+	}
+	info := &BucketInfo{}
+	if err = json.Unmarshal(v.BytesNoCopy(), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (tx *Tx) setBucketInfo(name []byte, info *BucketInfo) error {
+	dbi, err := tx.openMeta(true)
+	if err != nil {
+		return wrapError("create bucket", name, err)
+	}
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return wrapError("create bucket", name, tx.txn.Put(dbi, metaKey(bucketPrefix, name), v, 0))
+}
+
+// deleteMeta removes the metadata of a bucket.
+func (tx *Tx) deleteMeta(name []byte) error {
+	dbi, err := tx.openMeta(false)
+	if err == mdb.NotFound {
+		return nil
+	} else if err != nil {
+		return wrapError("delete bucket", name, err)
+	}
+	for _, prefix := range [][]byte{sequencePrefix, bucketPrefix} {
+		err = tx.txn.Del(dbi, metaKey(prefix, name), nil)
+		if err != nil && err != mdb.NotFound {
+			return wrapError("delete bucket", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package bmdb
+
+import (
+	"github.com/missionMeteora/bmdb/mdb"
+)
+
+// cursorSlot identifies the cursors that can be renewed in place of each other.
+// The DUPSORT flag is part of it, since the cursors of a DUPSORT database are allocated differently.
+type cursorSlot struct {
+	dbi     mdb.DBI
+	dupSort bool
+}
+
+// readTxn is a reset read-only LMDB transaction kept in the pool of the DB, along with the cursors
+// it left to be renewed and its emptied cursor registry. Only these are reused: every transaction
+// begins with a new Tx, so the Tx, buckets and cursors of a closed transaction stay done.
+type readTxn struct {
+	txn         *mdb.Txn
+	idleCursors map[cursorSlot][]*mdb.Cursor
+	cursors     map[*Cursor]struct{}
+}
+
+// renewReadTx takes a read-only transaction from the pool and renews it.
+// Returns nil if the pool is empty or the transaction cannot be renewed.
+func (db *DB) renewReadTx() *readTxn {
+	db.poolMux.Lock()
+	n := len(db.readTxs)
+	if n == 0 {
+		db.poolMux.Unlock()
+		return nil
+	}
+	rt := db.readTxs[n-1]
+	db.readTxs[n-1] = nil
+	db.readTxs = db.readTxs[:n-1]
+	db.poolMux.Unlock()
+
+	if err := rt.txn.Renew(); err != nil {
+		rt.free()
+		return nil
+	}
+	return rt
+}
+
+// recycleReadTx puts a reset read-only transaction back into the pool,
+// it's freed if the pool is full or the database is closed.
+func (db *DB) recycleReadTx(rt *readTxn) {
+	db.poolMux.Lock()
+	if db.closed || len(db.readTxs) >= db.opts.ReadTxPoolSize {
+		db.poolMux.Unlock()
+		rt.free()
+		return
+	}
+	db.readTxs = append(db.readTxs, rt)
+	db.poolMux.Unlock()
+}
+
+// drainReadTxs frees the pooled transactions, it must be called before closing the environment.
+func (db *DB) drainReadTxs() {
+	db.poolMux.Lock()
+	for _, rt := range db.readTxs {
+		rt.free()
+	}
+	db.readTxs = nil
+	db.poolMux.Unlock()
+}
+
+// free releases the LMDB transaction along with its idle cursors.
+func (rt *readTxn) free() {
+	closeIdleCursors(rt.idleCursors)
+	rt.txn.Abort()
+}
+
+// poolable returns whether the transaction is reset to be reused once closed.
+func (tx *Tx) poolable() bool {
+	return !tx.writable && tx.db.opts.ReadTxPoolSize > 0
+}
+
+// abort ends the LMDB transaction without committing it,
+// a poolable transaction is reset to be recycled instead of being freed.
+func (tx *Tx) abort() {
+	tx.recycled = tx.poolable()
+	tx.closeCursors()
+	if tx.recycled {
+		tx.txn.Reset()
+	} else {
+		tx.txn.Abort()
+	}
+}
+
+// recycle hands the reset LMDB transaction over to the pool of the DB, the transaction keeps none of it.
+func (tx *Tx) recycle() {
+	rt := tx.pooled
+	if rt == nil {
+		rt = &readTxn{}
+	}
+	rt.txn, rt.idleCursors, rt.cursors = tx.txn, tx.idleCursors, tx.cursors
+	tx.pooled, tx.idleCursors, tx.cursors = nil, nil, nil
+	tx.db.recycleReadTx(rt)
+}
+
+func closeIdleCursors(idle map[cursorSlot][]*mdb.Cursor) {
+	for _, cursors := range idle {
+		for _, mc := range cursors {
+			mc.Close()
+		}
+	}
+}
+
+// cursorOpen opens a cursor, renewing one that was kept by a poolable transaction if there is one.
+func (tx *Tx) cursorOpen(slot cursorSlot) (*mdb.Cursor, error) {
+	if tx.poolable() {
+		tx.mux.Lock()
+		var mc *mdb.Cursor
+		if cursors := tx.idleCursors[slot]; len(cursors) > 0 {
+			mc = cursors[len(cursors)-1]
+			tx.idleCursors[slot] = cursors[:len(cursors)-1]
+		}
+		tx.mux.Unlock()
+		if mc != nil {
+			if err := tx.txn.CursorRenew(mc); err == nil {
+				return mc, nil
+			}
+			mc.Close()
+		}
+	}
+	return tx.txn.CursorOpen(slot.dbi)
+}
+
+// keepCursor keeps the cursor of a poolable transaction to be renewed, the caller holds the lock.
+func (tx *Tx) keepCursor(c *Cursor) {
+	if tx.idleCursors == nil {
+		tx.idleCursors = make(map[cursorSlot][]*mdb.Cursor)
+	}
+	tx.idleCursors[c.slot] = append(tx.idleCursors[c.slot], c.cursor)
+}
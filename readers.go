@@ -0,0 +1,56 @@
+package bmdb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ReaderInfo describes a slot of the reader lock table.
+type ReaderInfo struct {
+	PID    int    // ID of the process owning the slot
+	Thread uint64 // ID of the thread owning the slot
+	TxnID  uint64 // ID of the snapshot being read, zero if the slot holds no active transaction
+}
+
+// Readers returns the slots of the reader lock table that are in use.
+func (db *DB) Readers() ([]ReaderInfo, error) {
+	if db.closed {
+		return nil, ErrDatabaseNotOpen
+	}
+	var readers []ReaderInfo
+	err := db.env.ReaderList(func(msg string) error {
+		fields := strings.Fields(msg)
+		if len(fields) != 3 {
+			return nil
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			// the header line
+			return nil
+		}
+		r := ReaderInfo{PID: pid}
+		if r.Thread, err = strconv.ParseUint(fields[1], 16, 64); err != nil {
+			return err
+		}
+		if fields[2] != "-" {
+			if r.TxnID, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+				return err
+			}
+		}
+		readers = append(readers, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readers, nil
+}
+
+// ClearStaleReaders clears the slots of the reader lock table that are held by dead processes,
+// e.g. after a crash, and returns the number of cleared slots.
+func (db *DB) ClearStaleReaders() (int, error) {
+	if db.closed {
+		return 0, ErrDatabaseNotOpen
+	}
+	return db.env.ReaderCheck()
+}
@@ -1,8 +1,11 @@
 package bmdb
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/missionMeteora/bmdb/mdb"
 )
@@ -13,104 +16,311 @@ import (
 type Tx struct {
 	db       *DB
 	txn      *mdb.Txn
+	id       uint64
+	ctx      context.Context
+	parent   *Tx
 	managed  bool
 	writable bool
 	done     bool
+	started  time.Time
 
 	// closeCallback is used to notify the parent DB about a closed transaction
 	closeCallback func()
 
 	// A protected registry.
-	mux            sync.RWMutex
-	commitHandlers []func()
-	cursors        map[*Cursor]struct{}
+	mux                  sync.RWMutex
+	commitHandlers       []func()
+	rollbackHandlers     []func()
+	beforeCommitHandlers []func(*Tx) error
+	cursors              map[*Cursor]struct{}
+	children             map[*Tx]struct{}
+	// noCopyBufs tracks the zero-copy values handed out in debug mode, they get poisoned on close.
+	noCopyBufs [][]byte
+	// dbis holds the bucket handles opened by the transaction, they are cached by the DB once it commits.
+	dbis map[string]mdb.DBI
+	// recycled is set when the LMDB transaction is reset to be reused from the pool of the DB instead of being freed,
+	// the cursors left by a poolable transaction are kept in idleCursors to be renewed.
+	// pooled is the pool entry the LMDB transaction was taken from, if any.
+	recycled    bool
+	idleCursors map[cursorSlot][]*mdb.Cursor
+	pooled      *readTxn
 }
 
+// poisonByte overwrites the zero-copy values of a closed transaction in debug mode.
+const poisonByte = 0xdb
+
 // CreateBucket creates a new bucket.
 // Returns an error if the bucket already exists, if the bucket name is blank, or if the bucket name is too long.
 func (tx *Tx) CreateBucket(name []byte) (*Bucket, error) {
-	if tx.done {
-		return nil, ErrTxDone
-	} else if len(name) == 0 {
-		return nil, ErrNoBucketName
-	} else if len(name) > MaxNameLength {
-		return nil, ErrNameTooLong
-	}
-	if b := tx.Bucket(name); b != nil {
-		return nil, ErrBucketExists
-	}
-	n := string(name)
-	dbi, err := tx.txn.DBIOpen(&n, mdb.CREATE)
-	if err != nil {
+	return tx.CreateBucketWithOptions(name, BucketOptions{})
+}
+
+// CreateBucketWithOptions creates a new bucket with the given options.
+// Returns an error if the bucket already exists, if the bucket name is blank, if the bucket name is too long,
+// or if the options are invalid.
+func (tx *Tx) CreateBucketWithOptions(name []byte, opts BucketOptions) (*Bucket, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	} else if err := checkName(name); err != nil {
 		return nil, err
 	}
-	return &Bucket{dbi: dbi, tx: tx}, nil
+	return tx.createBucket(name, opts)
 }
 
 // CreateBucketIfNotExists creates a new bucket if it doesn't already exist.
 // Returns an error if the bucket name is blank, or if the bucket name is too long.
 func (tx *Tx) CreateBucketIfNotExists(name []byte) (*Bucket, error) {
-	if tx.done {
-		return nil, ErrTxDone
+	if err := tx.check(); err != nil {
+		return nil, err
+	} else if tx.db.opts.ReadOnly {
+		return nil, ErrDatabaseReadOnly
 	} else if !tx.Writable() {
 		return nil, ErrTxNotWritable
-	} else if len(name) == 0 {
-		return nil, ErrNoBucketName
-	} else if len(name) > MaxNameLength {
-		return nil, ErrNameTooLong
+	} else if err := checkName(name); err != nil {
+		return nil, err
 	}
-	b := tx.Bucket(name)
-	if b != nil {
+	if b := tx.openBucket(name); b != nil {
 		return b, nil
 	}
-	return tx.CreateBucket(name)
+	return tx.createBucket(name, BucketOptions{})
 }
 
-// Bucket retrieves a bucket by name. Returns nil if the bucket does not exist.
+// Bucket retrieves a bucket by name. Returns nil if the bucket does not exist or cannot be opened,
+// use BucketE to tell them apart.
 func (tx *Tx) Bucket(name []byte) *Bucket {
-	if tx.done {
-		return nil
-	} else if len(name) == 0 {
+	if tx.check() != nil {
 		return nil
-	} else if len(name) > MaxNameLength {
+	} else if checkName(name) != nil {
 		return nil
 	}
-	// try to open an existing bucket
+	return tx.openBucket(name)
+}
+
+// createBucket creates a bucket from its full name, which is validated by the caller.
+func (tx *Tx) createBucket(name []byte, opts BucketOptions) (*Bucket, error) {
+	if tx.db.opts.ReadOnly {
+		return nil, ErrDatabaseReadOnly
+	} else if !tx.Writable() {
+		return nil, ErrTxNotWritable
+	} else if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	opts.Flags &^= CREATE
+	if b := tx.openBucket(name); b != nil {
+		return nil, ErrBucketExists
+	}
 	n := string(name)
-	dbi, err := tx.txn.DBIOpen(&n, 0)
+	flags := uint(opts.Flags) | mdb.CREATE
+	dbi, err := tx.dbiOpen(n, flags)
 	if err != nil {
-		return nil
+		return nil, wrapError("create bucket", name, err)
+	}
+	if err = tx.setComparators(dbi, opts); err != nil {
+		return nil, err
+	}
+	info := &BucketInfo{
+		Flags:         opts.Flags,
+		Comparator:    opts.Comparator,
+		DupComparator: opts.DupComparator,
+		Codec:         opts.Codec,
+		Created:       time.Now().UTC(),
+	}
+	if err = tx.setBucketInfo(name, info); err != nil {
+		return nil, err
+	}
+	// the options are only kept once the bucket exists for the other transactions
+	tx.OnCommit(func() { tx.db.recordBucketOptions(n, opts) })
+	// the caller may reuse the name, the bucket keeps its own copy
+	return &Bucket{dbi: dbi, tx: tx, name: bytes.Clone(name), flags: flags &^ mdb.CREATE}, nil
+}
+
+// BucketE retrieves a bucket by name.
+// Unlike Bucket it reports why no bucket was returned: ErrBucketNotFound if the bucket does not exist,
+// the name validation errors, or an *Error if the bucket could not be opened.
+func (tx *Tx) BucketE(name []byte) (*Bucket, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	} else if err := checkName(name); err != nil {
+		return nil, err
+	}
+	return tx.openBucketE(name)
+}
+
+// openBucket opens an existing bucket from its full name. Returns nil if the bucket does not exist.
+func (tx *Tx) openBucket(name []byte) *Bucket {
+	b, _ := tx.openBucketE(name)
+	return b
+}
+
+// openBucketE opens an existing bucket from its full name. A bucket that is not already open is opened
+// with the flags recorded in its metadata, and the comparators of the record are applied to it
+// unless it has options in Options.Buckets.
+func (tx *Tx) openBucketE(name []byte) (*Bucket, error) {
+	n := string(name)
+	dbi, ok := tx.lookupDBI(n)
+	if !ok {
+		info, err := tx.bucketInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		var flags uint
+		if info != nil {
+			flags = uint(info.Flags)
+		}
+		if dbi, err = tx.openDBI(n, flags); err == mdb.NotFound {
+			return nil, ErrBucketNotFound
+		} else if err != nil {
+			return nil, wrapError("open bucket", name, err)
+		}
+		if info != nil {
+			tx.db.recordBucketOptions(n, info.options())
+		} else {
+			tx.db.forgetBucketOptions(n)
+		}
+	}
+	flags, err := tx.txn.DBIFlags(dbi)
+	if err != nil {
+		return nil, wrapError("open bucket", name, err)
+	}
+	b := &Bucket{dbi: dbi, tx: tx, name: bytes.Clone(name), flags: flags}
+	if opts, ok := tx.db.bucketOptions(n); ok {
+		if err = tx.setComparators(dbi, opts); err != nil {
+			return nil, wrapError("open bucket", name, err)
+		}
+	}
+	return b, nil
+}
+
+// dbiOpen opens the handle of a named bucket, it's looked up in the handles opened by the transaction
+// and its parents, and then in the handles cached by the DB before asking LMDB.
+// A cached handle may not be valid in the transaction if the bucket was created after the transaction began.
+func (tx *Tx) dbiOpen(name string, flags uint) (mdb.DBI, error) {
+	if dbi, ok := tx.lookupDBI(name); ok {
+		return dbi, nil
+	}
+	return tx.openDBI(name, flags)
+}
+
+// lookupDBI returns the handle of a named bucket if it's already open.
+func (tx *Tx) lookupDBI(name string) (mdb.DBI, bool) {
+	for t := tx; t != nil; t = t.parent {
+		t.mux.RLock()
+		dbi, ok := t.dbis[name]
+		t.mux.RUnlock()
+		if ok {
+			return dbi, true
+		}
+	}
+	if dbi, ok := tx.db.cachedDBI(name); ok {
+		if _, err := tx.txn.DBIFlags(dbi); err == nil {
+			return dbi, true
+		}
 	}
-	return &Bucket{dbi: dbi, tx: tx}
+	return 0, false
 }
 
-// BucketNames XXX.
+// openDBI opens the handle of a named bucket in LMDB, it's kept by the transaction until it commits.
+// Returns ErrTooManyBuckets once all the handles allowed by Options.MaxBuckets are in use.
+func (tx *Tx) openDBI(name string, flags uint) (mdb.DBI, error) {
+	dbi, err := tx.txn.DBIOpen(&name, flags)
+	if err == mdb.DbsFull {
+		return 0, ErrTooManyBuckets
+	} else if err != nil {
+		return 0, err
+	}
+	tx.mux.Lock()
+	if tx.dbis == nil {
+		tx.dbis = make(map[string]mdb.DBI)
+	}
+	tx.dbis[name] = dbi
+	tx.mux.Unlock()
+	return dbi, nil
+}
+
+// forgetDBI removes the handle of a dropped bucket from the transaction, its parents and the DB cache.
+func (tx *Tx) forgetDBI(name string) {
+	for t := tx; t != nil; t = t.parent {
+		t.mux.Lock()
+		delete(t.dbis, name)
+		t.mux.Unlock()
+	}
+	tx.db.uncacheDBI(name)
+}
+
+// BucketNames returns the unnamed bucket that holds the names of all the buckets as its keys.
+// The nested buckets and the internal buckets used by BMDB are hidden from it.
 func (tx *Tx) BucketNames() *Bucket {
 	// try to open an existing bucket
 	dbi, err := tx.txn.DBIOpen(nil, 0)
 	if err != nil {
 		return nil
 	}
-	return &Bucket{dbi: dbi, tx: tx}
+	return &Bucket{dbi: dbi, tx: tx, names: true}
 }
 
-// DeleteBucket deletes a bucket.
+// DeleteBucket deletes a bucket along with its nested buckets.
 // Returns an error if the bucket cannot be found or the provided name was incorrect.
 func (tx *Tx) DeleteBucket(name []byte) error {
-	if tx.done {
-		return ErrTxDone
-	} else if len(name) == 0 {
-		return ErrNoBucketName
-	} else if len(name) > MaxNameLength {
-		return ErrNameTooLong
+	if err := tx.check(); err != nil {
+		return err
+	} else if err := checkName(name); err != nil {
+		return err
 	} else if !tx.Writable() {
 		return ErrTxNotWritable
 	}
-	b := tx.Bucket(name)
-	if b != nil {
-		return tx.txn.Drop(b.dbi, 1)
+	return tx.deleteBucket(name)
+}
+
+// deleteBucket deletes a bucket and all its nested buckets from its full name.
+func (tx *Tx) deleteBucket(name []byte) error {
+	if tx.openBucket(name) == nil {
+		return ErrBucketNotFound
+	}
+	children, err := tx.nestedBucketNames(name, true)
+	if err != nil {
+		return err
+	}
+	for _, child := range append(children, name) {
+		b := tx.openBucket(child)
+		if b == nil {
+			continue
+		}
+		if err := tx.deleteMeta(child); err != nil {
+			return err
+		}
+		// the handle is closed by the drop even if the transaction doesn't commit
+		err := tx.txn.Drop(b.dbi, 1)
+		tx.forgetDBI(string(child))
+		// the options are read again from the metadata if the bucket is opened again
+		tx.db.forgetBucketOptions(string(child))
+		if err != nil {
+			return wrapError("delete bucket", child, err)
+		}
 	}
-	return ErrBucketNotFound
+	return nil
+}
+
+// nestedBucketNames returns the full names of the buckets nested in the named bucket,
+// either only its direct children or all its descendants.
+func (tx *Tx) nestedBucketNames(name []byte, all bool) ([][]byte, error) {
+	dbi, err := tx.txn.DBIOpen(nil, 0)
+	if err != nil {
+		return nil, wrapError("bucket names", nil, err)
+	}
+	c, err := (&Bucket{dbi: dbi, tx: tx}).Cursor()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	prefix := nestedName(name, nil)
+	var names [][]byte
+	for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if !all && bytes.IndexByte(k[len(prefix):], bucketSeparator) >= 0 {
+			continue
+		}
+		names = append(names, k)
+	}
+	return names, tx.check()
 }
 
 // OnCommit adds a handler function to be executed after the transaction successfully commits.
@@ -120,6 +330,106 @@ func (tx *Tx) OnCommit(fn func()) {
 	tx.mux.Unlock()
 }
 
+// OnRollback adds a handler function to be executed after the transaction is rolled back,
+// aborted or fails to commit, i.e. to release the resources tied to its updates.
+// The handlers are executed in the reverse order they were added.
+// The handlers of a committed nested transaction are executed if its parent doesn't commit.
+func (tx *Tx) OnRollback(fn func()) {
+	tx.mux.Lock()
+	tx.rollbackHandlers = append(tx.rollbackHandlers, fn)
+	tx.mux.Unlock()
+}
+
+// BeforeCommit adds a handler function to be executed when the transaction is about to commit,
+// in the order they were added. The handlers can still update the transaction. If one returns an error
+// the commit is vetoed: the transaction is rolled back and Commit returns the error.
+func (tx *Tx) BeforeCommit(fn func(*Tx) error) {
+	tx.mux.Lock()
+	tx.beforeCommitHandlers = append(tx.beforeCommitHandlers, fn)
+	tx.mux.Unlock()
+}
+
+// Begin starts a nested read/write transaction within the transaction.
+// Committing the child transaction merges its updates into the parent,
+// rolling it back discards only the updates made by the child.
+// The parent transaction must not be used until the child is closed.
+// Any child transaction that is still open when the parent is closed will be rolled back.
+// LMDB doesn't support nested transactions in a WRITEMAP environment, including one opened with
+// Options.NoSync, in which case ErrNestedTxUnsupported is returned.
+func (tx *Tx) Begin() (*Tx, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	} else if !tx.Writable() {
+		return nil, ErrTxNotWritable
+	} else if !tx.db.nestedTxSupported() {
+		return nil, ErrNestedTxUnsupported
+	}
+	txn, err := tx.db.env.BeginTxn(tx.txn, 0)
+	if err != nil {
+		err = wrapError("begin", nil, err)
+		tx.log(slog.LevelError, "failed to begin nested transaction", slog.Any("error", err))
+		return nil, err
+	}
+	child := &Tx{
+		db:       tx.db,
+		txn:      txn,
+		id:       tx.db.txSeq.Add(1),
+		ctx:      tx.ctx,
+		parent:   tx,
+		writable: true,
+		started:  time.Now(),
+		cursors:  make(map[*Cursor]struct{}, registryMapCap),
+	}
+	tx.registerChild(child)
+	child.log(slog.LevelDebug, "transaction started")
+	tx.db.txBegan(child)
+	child.closeCallback = func() {
+		if tx.done {
+			return
+		}
+		tx.unregisterChild(child)
+	}
+	return child, nil
+}
+
+// Update executes a function within the context of a managed nested transaction.
+// If no error is returned from the function then the nested transaction is committed into its parent.
+// If an error is returned then only the updates made by the function are rolled back.
+// Any error that is returned from the function or returned from the commit is returned from the Update() method.
+// Like Begin, it returns ErrNestedTxUnsupported in a WRITEMAP environment.
+func (tx *Tx) Update(fn func(*Tx) error) error {
+	child, err := tx.Begin()
+	if err != nil {
+		return err
+	}
+	return child.run(child.ctx, fn)
+}
+
+// run executes a function within the managed transaction bound to the context,
+// the transaction is committed unless the function fails or the context is done.
+func (tx *Tx) run(ctx context.Context, fn func(*Tx) error) error {
+	tx.ctx = ctx
+	tx.managed = true
+	defer func() {
+		// roll back on panic, so that the write lock and the OS thread are released
+		if p := recover(); p != nil {
+			tx.managed = false
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	err := fn(tx)
+	tx.managed = false
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // Rollback closes the transaction and ignores all previous updates.
 func (tx *Tx) Rollback() error {
 	tx.mux.Lock()
@@ -130,23 +440,22 @@ func (tx *Tx) Rollback() error {
 		return ErrTxDone
 	}
 	tx.done = true
-	tx.txn.Abort()
-	if !tx.Writable() {
-		for c := range tx.cursors {
-			c.Close()
-		}
-	}
-	tx.cursors = nil
-	tx.commitHandlers = nil
-	if tx.closeCallback != nil {
-		tx.closeCallback()
-	}
+	tx.closeChildren()
+	tx.abort()
+	tx.log(slog.LevelDebug, "transaction rolled back", slog.Duration("duration", time.Since(tx.started)))
+	tx.release(false)
 	return nil
 }
 
 // Commit commits all the operations of a transaction into the database and writes to the disk.
 // The transaction handle is freed. It and its cursors must not be used again after this call.
+// Committing a nested transaction merges its updates into the parent transaction,
+// its commit handlers will be executed after the parent successfully commits.
 func (tx *Tx) Commit() error {
+	if err := tx.beforeCommit(); err != nil {
+		tx.Rollback()
+		return err
+	}
 	tx.mux.Lock()
 	defer tx.mux.Unlock()
 	if tx.managed {
@@ -155,25 +464,58 @@ func (tx *Tx) Commit() error {
 		return ErrTxDone
 	}
 	tx.done = true
-	err := tx.txn.Commit()
-	if err != nil {
-		fmt.Println("BMDB: error committing:", err)
+	tx.closeChildren()
+	start := time.Now()
+	var err error
+	if tx.poolable() && len(tx.dbis) == 0 {
+		// a read-only transaction has nothing to commit but the handles it opened
+		tx.abort()
 	} else {
+		tx.closeCursors()
+		err = wrapError("commit", nil, tx.txn.Commit())
+	}
+	tx.logCommit(time.Since(start), err)
+	if err == nil && tx.parent != nil {
+		for _, hdl := range tx.commitHandlers {
+			tx.parent.OnCommit(hdl)
+		}
+		// the updates of the child are undone if the parent doesn't commit
+		for _, hdl := range tx.rollbackHandlers {
+			tx.parent.OnRollback(hdl)
+		}
+		tx.parent.mux.Lock()
+		for name, dbi := range tx.dbis {
+			if tx.parent.dbis == nil {
+				tx.parent.dbis = make(map[string]mdb.DBI, len(tx.dbis))
+			}
+			tx.parent.dbis[name] = dbi
+		}
+		tx.parent.mux.Unlock()
+	} else if err == nil {
+		tx.db.cacheDBIs(tx.dbis)
 		for _, hdl := range tx.commitHandlers {
 			hdl()
 		}
 	}
-	if !tx.Writable() {
-		for c := range tx.cursors {
-			c.Close()
+	tx.release(err == nil)
+	return err
+}
+
+// beforeCommit executes the before commit handlers, it stops at the first error.
+// The handlers are called without holding the lock, so that they can use the transaction.
+func (tx *Tx) beforeCommit() error {
+	for i := 0; ; i++ {
+		tx.mux.RLock()
+		if tx.managed || tx.done || i >= len(tx.beforeCommitHandlers) {
+			tx.mux.RUnlock()
+			return nil
+		}
+		fn := tx.beforeCommitHandlers[i]
+		tx.mux.RUnlock()
+		if err := fn(tx); err != nil {
+			return err
 		}
 	}
-	tx.cursors = nil
-	tx.commitHandlers = nil
-	if tx.closeCallback != nil {
-		tx.closeCallback()
-	}
-	return err
 }
 
 // Writable returns whether the transaction can perform write operations.
@@ -181,6 +523,20 @@ func (tx *Tx) Writable() bool {
 	return tx.writable
 }
 
+// Context returns the context the transaction was started with.
+// Transactions started without a context return context.Background().
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// check returns an error if the transaction is done or its context is done.
+func (tx *Tx) check() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return tx.ctx.Err()
+}
+
 func (tx *Tx) close() {
 	if tx.done {
 		return
@@ -188,16 +544,92 @@ func (tx *Tx) close() {
 	tx.done = true
 	tx.mux.Lock()
 	defer tx.mux.Unlock()
-	tx.txn.Abort()
-	if !tx.Writable() {
-		for c := range tx.cursors {
-			c.Close()
+	tx.closeChildren()
+	tx.abort()
+	tx.log(slog.LevelDebug, "transaction aborted", slog.Duration("duration", time.Since(tx.started)))
+	tx.release(false)
+}
+
+// closeChildren aborts the nested transactions, they must be closed before their parent.
+func (tx *Tx) closeChildren() {
+	for child := range tx.children {
+		child.close()
+	}
+	tx.children = nil
+}
+
+// closeCursors closes the cursors left open, they must be closed before the transaction ends.
+// The cursors of a recycled transaction are kept to be renewed instead.
+func (tx *Tx) closeCursors() {
+	for c := range tx.cursors {
+		if tx.recycled {
+			tx.keepCursor(c)
+		} else {
+			c.cursor.Close()
 		}
 	}
-	tx.cursors = nil
+	clear(tx.cursors)
+	if !tx.recycled {
+		closeIdleCursors(tx.idleCursors)
+		tx.idleCursors = nil
+	}
+}
+
+// release frees the resources bound to a closed transaction,
+// the rollback handlers are executed unless the transaction was committed.
+func (tx *Tx) release(committed bool) {
+	if !committed {
+		for i := len(tx.rollbackHandlers) - 1; i >= 0; i-- {
+			tx.rollbackHandlers[i]()
+		}
+	}
+	tx.rollbackHandlers = nil
+	tx.beforeCommitHandlers = nil
+	tx.commitHandlers = nil
+	for _, buf := range tx.noCopyBufs {
+		for i := range buf {
+			buf[i] = poisonByte
+		}
+	}
+	tx.noCopyBufs = nil
 	if tx.closeCallback != nil {
 		tx.closeCallback()
 	}
+	tx.db.txEnded(tx, committed)
+	if tx.recycled {
+		tx.recycle()
+	}
+}
+
+// bytesNoCopy returns the bytes of val without copying them. In debug mode they are copied
+// instead and tracked, so that using them after the transaction is closed can be detected.
+// A writable transaction always copies them, an update can move or overwrite them in the map.
+func (tx *Tx) bytesNoCopy(val *mdb.Val) []byte {
+	if tx.writable {
+		return val.Bytes()
+	} else if !tx.db.opts.DebugNoCopy {
+		return val.BytesNoCopy()
+	}
+	buf := val.Bytes()
+	tx.mux.Lock()
+	tx.noCopyBufs = append(tx.noCopyBufs, buf)
+	tx.mux.Unlock()
+	return buf
+}
+
+func (tx *Tx) registerChild(child *Tx) {
+	tx.mux.Lock()
+	if tx.children == nil {
+		tx.children = make(map[*Tx]struct{})
+	}
+	tx.children[child] = struct{}{}
+	tx.mux.Unlock()
+}
+
+func (tx *Tx) unregisterChild(child *Tx) {
+	tx.mux.Lock()
+	delete(tx.children, child)
+	tx.mux.Unlock()
 }
 
 func (tx *Tx) registerCursor(c *Cursor) {
@@ -206,6 +638,22 @@ func (tx *Tx) registerCursor(c *Cursor) {
 	tx.mux.Unlock()
 }
 
+// closeCursor removes a cursor from the registry and closes it, unless the transaction is poolable
+// and the cursor can be kept to be renewed. Closing a cursor that was already removed has no effect.
+func (tx *Tx) closeCursor(c *Cursor) error {
+	tx.mux.Lock()
+	defer tx.mux.Unlock()
+	if _, ok := tx.cursors[c]; !ok {
+		return nil
+	}
+	delete(tx.cursors, c)
+	if tx.poolable() {
+		tx.keepCursor(c)
+		return nil
+	}
+	return c.cursor.Close()
+}
+
 func (tx *Tx) activeCursorsCount() int {
 	tx.mux.RLock()
 	n := len(tx.cursors)
@@ -0,0 +1,148 @@
+package bmdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNestedTx(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		errBadRecord := errors.New("bad record")
+		var committed []string
+		assert.NoError(db.Update(func(tx *Tx) error {
+			if err := tx.Put([]byte("first"), BAR); err != nil {
+				return err
+			}
+			err := tx.Update(func(child *Tx) error {
+				child.OnCommit(func() { committed = append(committed, "bad") })
+				if err := child.Put([]byte("bad"), BAR); err != nil {
+					return err
+				}
+				return errBadRecord
+			})
+			assert.Equal(errBadRecord, err)
+			return tx.Update(func(child *Tx) error {
+				child.OnCommit(func() { committed = append(committed, "good") })
+				return child.Put([]byte("good"), BAR)
+			})
+		}))
+		assert.Equal([]string{"good"}, committed)
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal(BAR, tx.Get([]byte("first")))
+			assert.Equal(BAR, tx.Get([]byte("good")))
+			assert.Nil(tx.Get([]byte("bad")))
+			return nil
+		}))
+
+		tx, err := db.Begin(true)
+		if !assert.NoError(err) {
+			return
+		}
+		child, err := tx.Begin()
+		if !assert.NoError(err) {
+			return
+		}
+		assert.NoError(child.Put(FOO, BAR))
+		assert.NoError(tx.Rollback())
+		assert.Equal(ErrTxDone, child.Commit())
+		assert.Equal(0, db.activeTransactionsCount())
+
+		rtx, err := db.Begin(false)
+		if !assert.NoError(err) {
+			return
+		}
+		_, err = rtx.Begin()
+		assert.Equal(ErrTxNotWritable, err)
+		assert.Nil(rtx.Get(FOO))
+		assert.NoError(rtx.Rollback())
+	})
+}
+
+func TestNestedTxWriteMap(t *testing.T) {
+	assert := assert.New(t)
+	db, err := getDBWithOptions(&Options{NoSync: true})
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+	assert.NoError(db.Update(func(tx *Tx) error {
+		_, err := tx.Begin()
+		assert.Equal(ErrNestedTxUnsupported, err)
+		assert.Equal(ErrNestedTxUnsupported, tx.Update(func(*Tx) error { return nil }))
+		// the parent is still usable
+		return tx.Put(FOO, BAR)
+	}))
+	assert.NoError(db.View(func(tx *Tx) error {
+		assert.Equal(BAR, tx.Get(FOO))
+		return nil
+	}))
+}
+
+func TestTxHooks(t *testing.T) {
+	testWrap(t, func(db *DB) {
+		assert := assert.New(t)
+		errInvalid := errors.New("invalid")
+		var began, ended, committed int
+		db.OnTxBegin(func(*Tx) { began++ })
+		db.OnTxEnd(func(_ *Tx, ok bool) {
+			ended++
+			if ok {
+				committed++
+			}
+		})
+
+		var events []string
+		err := db.Update(func(tx *Tx) error {
+			tx.OnRollback(func() { events = append(events, "rollback 1") })
+			tx.OnRollback(func() { events = append(events, "rollback 2") })
+			tx.OnCommit(func() { events = append(events, "commit") })
+			tx.BeforeCommit(func(tx *Tx) error {
+				events = append(events, "before commit")
+				if tx.Get(FOO) == nil {
+					return errInvalid
+				}
+				return nil
+			})
+			return tx.Put(BAR, BAR)
+		})
+		assert.Equal(errInvalid, err)
+		assert.Equal([]string{"before commit", "rollback 2", "rollback 1"}, events)
+
+		events = events[:0]
+		assert.NoError(db.Update(func(tx *Tx) error {
+			tx.OnRollback(func() { events = append(events, "rollback") })
+			tx.OnCommit(func() { events = append(events, "commit") })
+			tx.BeforeCommit(func(tx *Tx) error {
+				return tx.Put(FOO, BAR)
+			})
+			return nil
+		}))
+		assert.Equal([]string{"commit"}, events)
+		assert.NoError(db.View(func(tx *Tx) error {
+			assert.Equal(BAR, tx.Get(FOO))
+			assert.Nil(tx.Get(BAR))
+			return nil
+		}))
+
+		// the rollback handlers of a committed child run when its parent is rolled back
+		events = events[:0]
+		tx, err := db.Begin(true)
+		if !assert.NoError(err) {
+			return
+		}
+		assert.NoError(tx.Update(func(child *Tx) error {
+			child.OnRollback(func() { events = append(events, "child rollback") })
+			return nil
+		}))
+		assert.Empty(events)
+		assert.NoError(tx.Rollback())
+		assert.Equal([]string{"child rollback"}, events)
+
+		assert.Equal(5, began)
+		assert.Equal(5, ended)
+		assert.Equal(3, committed)
+	})
+}
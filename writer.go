@@ -0,0 +1,151 @@
+package bmdb
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// WritePriority orders the Update functions waiting for the dedicated writer,
+// the functions of a higher priority are executed first and the ones of the same priority in order.
+type WritePriority int
+
+const (
+	PriorityLow WritePriority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// writeReq is an Update function submitted to the dedicated writer.
+// started is set, under the lock of the writer, once the writer has taken the request from its queue.
+type writeReq struct {
+	ctx     context.Context
+	fn      func(*Tx) error
+	done    chan writeResult
+	started bool
+}
+
+type writeResult struct {
+	err   error
+	panic any
+}
+
+// writer executes the Update functions of a DB on a single goroutine locked to its OS thread.
+type writer struct {
+	mux     sync.Mutex
+	queues  [PriorityHigh + 1][]*writeReq
+	stopped bool
+
+	wake   chan struct{}
+	exited chan struct{}
+}
+
+func newWriter() *writer {
+	return &writer{
+		wake:   make(chan struct{}, 1),
+		exited: make(chan struct{}),
+	}
+}
+
+// submit queues the function and waits for its result. If the function panics the panic is raised
+// again in the caller. Returns the context's error if it's done before the function is started,
+// once started the result of the function is always awaited, since it may still commit.
+func (w *writer) submit(ctx context.Context, priority WritePriority, fn func(*Tx) error) error {
+	if priority < PriorityLow {
+		priority = PriorityLow
+	} else if priority > PriorityHigh {
+		priority = PriorityHigh
+	}
+	req := &writeReq{ctx: ctx, fn: fn, done: make(chan writeResult, 1)}
+	w.mux.Lock()
+	if w.stopped {
+		w.mux.Unlock()
+		return ErrDatabaseNotOpen
+	}
+	w.queues[priority] = append(w.queues[priority], req)
+	w.mux.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+
+	var res writeResult
+	select {
+	case res = <-req.done:
+	case <-ctx.Done():
+		w.mux.Lock()
+		started := req.started
+		w.mux.Unlock()
+		if !started {
+			// the writer skips the functions whose context is done
+			return ctx.Err()
+		}
+		res = <-req.done
+	}
+	if res.panic != nil {
+		panic(res.panic)
+	}
+	return res.err
+}
+
+// next pops the oldest request of the highest priority, it returns nil if the queues are empty.
+// It also returns whether the writer is stopped, read along with the queues: once they are empty
+// and the writer is stopped no request can be queued anymore.
+func (w *writer) next() (*writeReq, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		if q := w.queues[p]; len(q) > 0 {
+			req := q[0]
+			q[0] = nil
+			w.queues[p] = q[1:]
+			req.started = true
+			return req, w.stopped
+		}
+	}
+	return nil, w.stopped
+}
+
+// stop makes the writer fail the queued and the future requests, and exit once it's idle.
+func (w *writer) stop() {
+	w.mux.Lock()
+	w.stopped = true
+	w.mux.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runWriter is the loop of the dedicated writer goroutine. The goroutine stays locked to its OS thread,
+// so the thread is not reused by other goroutines and it's terminated when the loop exits.
+func (db *DB) runWriter(w *writer) {
+	runtime.LockOSThread()
+	defer close(w.exited)
+	for {
+		req, stopped := w.next()
+		if req == nil {
+			if stopped {
+				return
+			}
+			<-w.wake
+			continue
+		}
+		req.done <- db.execWrite(w, req)
+	}
+}
+
+func (db *DB) execWrite(w *writer, req *writeReq) (res writeResult) {
+	defer func() {
+		if p := recover(); p != nil {
+			res.panic = p
+		}
+	}()
+	w.mux.Lock()
+	stopped := w.stopped
+	w.mux.Unlock()
+	if stopped {
+		return writeResult{err: ErrDatabaseNotOpen}
+	}
+	return writeResult{err: db.updateGrow(req.ctx, req.fn)}
+}